@@ -24,8 +24,9 @@ func main() {
 		log.Fatalf("Failed to create config directory: %v", err)
 	}
 
-	// Load configuration
-	cfg, err := config.Load(*configPath)
+	// Load configuration, secrets stay unresolved so the build neither needs
+	// them nor writes them into generated code
+	cfg, err := config.LoadUnresolved(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
@@ -37,6 +38,9 @@ func main() {
 	}
 	defer logger.Sync()
 
+	// Trace WSDL parsing while generating
+	generators.Verbose = true
+
 	// Initialize template generator
 	templateGen := generators.NewTemplateGenerator()
 	if err := templateGen.GenerateTemplates(cfg); err != nil {
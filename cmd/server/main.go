@@ -13,16 +13,25 @@ import (
 	"time"
 
 	"rest-to-soap/core/config"
+	"rest-to-soap/core/logging"
 	"rest-to-soap/core/server/handler"
+	"rest-to-soap/core/server/metrics"
 
 	"go.uber.org/zap"
 )
 
 var (
-	configPath = flag.String("config", "config/config.json", "path to config file")
+	configPath  = flag.String("config", "config/config.json", "path to config file")
+	metricsPort = flag.Int("metrics-port", 9090, "port of the Prometheus metrics listener, 0 disables it")
+	watch       = flag.Duration("watch", 0, "interval at which config and template files are checked for changes, 0 disables watching")
 )
 
 func main() {
+	// `server validate [-config path]` checks a configuration and exits
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	flag.Parse()
 
 	// Ensure config directory exists
@@ -37,15 +46,24 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	// Initialize logger
-	logger, err := initLogger(cfg.Logging)
+	// Initialize logger, values resolved from the environment and secret files
+	// are redacted from every entry
+	redactor := logging.NewRedactor()
+	redactor.Add(cfg.Secrets())
+	logger, err := initLogger(cfg.Logging, redactor.Option())
 	if err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 	defer logger.Sync()
 
+	// Create metrics
+	var m *metrics.Metrics
+	if *metricsPort != 0 {
+		m = metrics.New()
+	}
+
 	// Create handler
-	h, err := handler.NewHandler(cfg, logger)
+	h, err := handler.NewHandler(cfg, logger, m)
 	if err != nil {
 		logger.Fatal("Failed to create handler", zap.Error(err))
 	}
@@ -70,10 +88,39 @@ func main() {
 		}
 	}()
 
+	// Start metrics server
+	var metricsSrv *http.Server
+	if m != nil {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", m.Handler())
+		metricsSrv = &http.Server{
+			Addr:    fmt.Sprintf(":%d", *metricsPort),
+			Handler: metricsMux,
+		}
+
+		go func() {
+			logger.Info("Starting metrics server", zap.Int("port", *metricsPort))
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("Metrics server failed to start", zap.Error(err))
+			}
+		}()
+	}
+
+	// Reload routes and templates on SIGHUP and, when enabled, on file changes
+	reloader := newReloader(*configPath, cfg, h, redactor, logger)
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if *watch > 0 {
+		go reloader.watch(watchCtx, *watch)
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := <-quit; sig == syscall.SIGHUP; sig = <-quit {
+		reloader.reload("SIGHUP")
+	}
+	stopWatch()
 
 	logger.Info("Shutting down server...")
 
@@ -86,10 +133,16 @@ func main() {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
 
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			logger.Error("Metrics server forced to shutdown", zap.Error(err))
+		}
+	}
+
 	logger.Info("Server exited properly")
 }
 
-func initLogger(cfg config.LogConfig) (*zap.Logger, error) {
+func initLogger(cfg config.LogConfig, opts ...zap.Option) (*zap.Logger, error) {
 	var config zap.Config
 
 	if cfg.Format == "json" {
@@ -112,5 +165,5 @@ func initLogger(cfg config.LogConfig) (*zap.Logger, error) {
 		config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
 	}
 
-	return config.Build()
+	return config.Build(opts...)
 }
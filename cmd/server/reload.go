@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"rest-to-soap/core/config"
+	"rest-to-soap/core/logging"
+	"rest-to-soap/core/server/handler"
+
+	"go.uber.org/zap"
+)
+
+// reloader re-reads the configuration and swaps the routes of the handler
+type reloader struct {
+	configPath string
+	handler    *handler.Handler
+	redactor   *logging.Redactor
+	logger     *zap.Logger
+
+	mu    sync.Mutex
+	files []string
+}
+
+func newReloader(configPath string, cfg *config.Config, h *handler.Handler, redactor *logging.Redactor, logger *zap.Logger) *reloader {
+	return &reloader{
+		configPath: configPath,
+		handler:    h,
+		redactor:   redactor,
+		logger:     logger,
+		files:      watchedFiles(configPath, cfg),
+	}
+}
+
+// reload loads the configuration and applies it. A broken configuration is
+// logged and rejected, the server keeps serving the previous routes.
+func (r *reloader) reload(reason string) {
+	r.logger.Info("Reloading configuration",
+		zap.String("config", r.configPath),
+		zap.String("reason", reason),
+	)
+
+	cfg, err := config.Load(r.configPath)
+	if err != nil {
+		r.logger.Error("Rejected configuration reload", zap.Error(err))
+		return
+	}
+	r.redactor.Add(cfg.Secrets())
+	if err := r.handler.Reload(cfg); err != nil {
+		r.logger.Error("Rejected configuration reload", zap.Error(err))
+		return
+	}
+
+	r.mu.Lock()
+	r.files = watchedFiles(r.configPath, cfg)
+	r.mu.Unlock()
+}
+
+// watch polls the configuration, templates and local WSDL files and reloads
+// when one of them changes
+func (r *reloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	r.mu.Lock()
+	state := fileState(r.files)
+	r.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		current := fileState(r.files)
+		r.mu.Unlock()
+		if current == state {
+			continue
+		}
+
+		r.reload("file change")
+
+		// Take the state after the reload so a rejected change is not retried
+		// until the files change again
+		r.mu.Lock()
+		state = fileState(r.files)
+		r.mu.Unlock()
+	}
+}
+
+// watchedFiles returns the files a configuration is built from: the
+// configuration and its includes, secret files, templates, certificates,
+// health check requests and local WSDLs
+func watchedFiles(configPath string, cfg *config.Config) []string {
+	files := append([]string{configPath}, cfg.Sources()...)
+	for _, route := range cfg.Routes {
+		files = append(files, route.RequestTemplate)
+		if route.ResponseTemplate != "" {
+			files = append(files, route.ResponseTemplate)
+		}
+		if route.Security != nil {
+			for _, file := range []string{route.Security.SignCert, route.Security.SignKey, route.Security.VerifyCert} {
+				if file != "" {
+					files = append(files, file)
+				}
+			}
+		}
+		if route.LoadBalancing != nil && route.LoadBalancing.HealthCheck != nil {
+			files = append(files, route.LoadBalancing.HealthCheck.Request)
+		}
+		if route.Mode == config.ModeDynamic && route.WSDLURL != "" &&
+			!strings.HasPrefix(route.WSDLURL, "http://") && !strings.HasPrefix(route.WSDLURL, "https://") {
+			files = append(files, route.WSDLURL)
+		}
+	}
+	return files
+}
+
+// fileState summarizes the modification time and size of files, missing files included
+func fileState(files []string) string {
+	var sb strings.Builder
+	for _, file := range files {
+		sb.WriteString(file)
+		if info, err := os.Stat(file); err == nil {
+			sb.WriteString(info.ModTime().String())
+			sb.WriteString(strconv.FormatInt(info.Size(), 10))
+		}
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
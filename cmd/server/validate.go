@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"rest-to-soap/core/build/generators"
+	"rest-to-soap/core/config"
+	transport "rest-to-soap/core/server/soap"
+	"rest-to-soap/core/templating"
+	"rest-to-soap/pkg/generated"
+)
+
+// runValidate implements `server validate`: it loads a configuration, checks
+// the files and WSDL operations its routes reference and prints every problem.
+// It returns the process exit code.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	path := flags.String("config", "config/config.json", "path to config file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*path)
+	if err != nil {
+		var invalid *config.ValidationError
+		if !errors.As(err, &invalid) {
+			fmt.Fprintf(stderr, "%s: %v\n", *path, err)
+			return 1
+		}
+		for _, problem := range invalid.Problems {
+			printProblem(stderr, *path, problem)
+		}
+		return 1
+	}
+
+	problems := validateRoutes(cfg)
+	for _, problem := range problems {
+		problem.Message = config.Redact(problem.Message, cfg.Secrets())
+		printProblem(stderr, *path, cfg.Locate(problem))
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%s: configuration OK, %d routes\n", *path, len(cfg.Routes))
+	return 0
+}
+
+// validateRoutes checks what the schema cannot: referenced templates parse,
+// certificates load, WSDL operations resolve and generated routes have a parser
+func validateRoutes(cfg *config.Config) []config.Problem {
+	var problems []config.Problem
+
+	for i, route := range cfg.Routes {
+		at := func(field string) string {
+			if field == "" {
+				return fmt.Sprintf("routes[%d]", i)
+			}
+			return fmt.Sprintf("routes[%d].%s", i, field)
+		}
+		report := func(field string, format string, args ...interface{}) {
+			problems = append(problems, config.Problem{Path: at(field), Message: fmt.Sprintf(format, args...)})
+		}
+
+		if _, err := templating.ParseRequestTemplate(route.RequestTemplate); err != nil {
+			report("request_template", "%v", err)
+		}
+		if route.ResponseMode != "auto" {
+			if route.ResponseTemplate == "" {
+				report("response_template", "is required unless response_mode is auto")
+			} else if _, err := templating.ParseResponseTemplate(route.ResponseTemplate); err != nil {
+				report("response_template", "%v", err)
+			}
+		}
+
+		if security := route.Security; security != nil {
+			if security.SignCert != "" || security.SignKey != "" {
+				if _, err := transport.LoadSigner(security.SignCert, security.SignKey); err != nil {
+					report("security", "%v", err)
+				}
+			}
+			if security.VerifyCert != "" {
+				if _, err := transport.LoadVerifier(security.VerifyCert); err != nil {
+					report("security.verify_cert", "%v", err)
+				}
+			}
+		}
+
+		if route.Retry != nil && !route.Idempotent {
+			report("retry", "only applies to routes marked idempotent")
+		}
+
+		if route.Coalesce && !route.Idempotent && route.HTTPMethod() != http.MethodGet {
+			report("coalesce", "sends identical concurrent calls once, mark the route idempotent if that is safe")
+		}
+
+		if tlsConfig := route.Transport.TLS; tlsConfig != nil {
+			_, err := transport.NewTLSConfig(transport.TLSOptions{
+				CAFile:       tlsConfig.CAFile,
+				CertFile:     tlsConfig.CertFile,
+				KeyFile:      tlsConfig.KeyFile,
+				ServerName:   tlsConfig.ServerName,
+				MinVersion:   tlsConfig.MinVersion,
+				CipherSuites: tlsConfig.CipherSuites,
+			})
+			if err != nil {
+				report("transport.tls", "%v", err)
+			}
+		}
+
+		if route.WSDLURL != "" {
+			if route.SoapAction == "" {
+				report("soap_action", "is required with wsdl_url")
+				continue
+			}
+			resolved, err := generators.ApplyOperationBinding(route)
+			if err != nil {
+				report("wsdl_url", "%v", err)
+				continue
+			}
+			route = resolved
+			requestSchema, err := generators.ExtractRequestSchema(route.WSDLURL, route.SoapAction)
+			if err != nil {
+				report("soap_action", "%v", err)
+			} else if route.ValidateRequest {
+				refs, err := route.ParamRefs()
+				if err != nil {
+					report("validate_params", "%v", err)
+				}
+				for _, ref := range refs {
+					if _, err := requestSchema.Lookup(ref.Element); err != nil {
+						report("validate_params."+ref.Key, "%v", err)
+					}
+				}
+			}
+			if _, err := generators.ExtractResponseSchema(route.WSDLURL, route.SoapAction); err != nil {
+				report("soap_action", "%v", err)
+			}
+		}
+
+		switch {
+		case route.SoapEndpoint != "" && len(route.SoapEndpoints) > 0:
+			report("soap_endpoints", "cannot be combined with soap_endpoint")
+		case len(route.Endpoints()) == 0:
+			report("soap_endpoint", "is required, the WSDL declares no service address")
+		}
+		if lb := route.LoadBalancing; lb != nil && lb.HealthCheck != nil {
+			if _, err := os.Stat(lb.HealthCheck.Request); err != nil {
+				report("load_balancing.health_check.request", "%v", err)
+			}
+		}
+
+		if route.Mode != config.ModeDynamic {
+			if registered, ok := generated.RouteHandlerRegistry[route.Key()]; !ok || registered.Parser == nil {
+				report("", "route %s has no generated parser, run cmd/build or use \"mode\": \"dynamic\"", route.Key())
+			}
+		}
+	}
+
+	return problems
+}
+
+// printProblem prints a problem prefixed by the file it was found in
+func printProblem(w io.Writer, path string, problem config.Problem) {
+	if problem.File == "" {
+		problem.File = path
+	}
+	fmt.Fprintln(w, problem)
+}
@@ -0,0 +1,158 @@
+package generators
+
+import (
+	"fmt"
+
+	"rest-to-soap/core/config"
+)
+
+type wsdlBinding struct {
+	Name       string                 `xml:"name,attr"`
+	Type       string                 `xml:"type,attr"`
+	Soap11     *wsdlSoapBinding       `xml:"http://schemas.xmlsoap.org/wsdl/soap/ binding"`
+	Soap12     *wsdlSoapBinding       `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ binding"`
+	Operations []wsdlBindingOperation `xml:"operation"`
+}
+
+type wsdlSoapBinding struct {
+	Style     string `xml:"style,attr"`
+	Transport string `xml:"transport,attr"`
+}
+
+type wsdlBindingOperation struct {
+	Name   string             `xml:"name,attr"`
+	Soap11 *wsdlSoapOperation `xml:"http://schemas.xmlsoap.org/wsdl/soap/ operation"`
+	Soap12 *wsdlSoapOperation `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ operation"`
+}
+
+type wsdlSoapOperation struct {
+	SoapAction string `xml:"soapAction,attr"`
+	Style      string `xml:"style,attr"`
+}
+
+type wsdlService struct {
+	Name  string `xml:"name,attr"`
+	Ports []struct {
+		Name    string       `xml:"name,attr"`
+		Binding string       `xml:"binding,attr"`
+		Soap11  *wsdlAddress `xml:"http://schemas.xmlsoap.org/wsdl/soap/ address"`
+		Soap12  *wsdlAddress `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ address"`
+	} `xml:"port"`
+}
+
+type wsdlAddress struct {
+	Location string `xml:"location,attr"`
+}
+
+// OperationBinding is what the binding and service sections of a WSDL say about an operation
+type OperationBinding struct {
+	SoapVersion string
+	Style       string
+	SoapAction  string
+	Endpoint    string
+}
+
+// ExtractOperationBinding finds the SOAP binding of an operation and the address of
+// the service port using it. When soapVersion is empty the SOAP 1.1 binding is
+// preferred over the SOAP 1.2 one.
+func ExtractOperationBinding(wsdlPath, operationName, soapVersion string) (*OperationBinding, error) {
+	wsdl, err := loadWSDL(wsdlPath)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []string{config.SoapVersion11, config.SoapVersion12}
+	if soapVersion != "" {
+		versions = []string{soapVersion}
+	}
+
+	for _, version := range versions {
+		for _, binding := range wsdl.Bindings {
+			soapBinding := binding.Soap11
+			if version == config.SoapVersion12 {
+				soapBinding = binding.Soap12
+			}
+			if soapBinding == nil {
+				continue
+			}
+
+			for _, op := range binding.Operations {
+				if op.Name != operationName {
+					continue
+				}
+				soapOp := op.Soap11
+				if version == config.SoapVersion12 {
+					soapOp = op.Soap12
+				}
+
+				result := &OperationBinding{
+					SoapVersion: version,
+					Style:       soapBinding.Style,
+					Endpoint:    serviceAddress(wsdl, binding.Name, version),
+				}
+				if soapOp != nil {
+					result.SoapAction = soapOp.SoapAction
+					if soapOp.Style != "" {
+						result.Style = soapOp.Style
+					}
+				}
+				// The binding style defaults to document when it is not declared
+				if result.Style == "" {
+					result.Style = "document"
+				}
+				return result, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no SOAP binding found for operation %s", operationName)
+}
+
+// serviceAddress returns the location of the first service port using a binding
+func serviceAddress(wsdl *wsdlDefinitions, bindingName, version string) string {
+	for _, service := range wsdl.Services {
+		for _, port := range service.Ports {
+			if localPart(port.Binding) != bindingName {
+				continue
+			}
+			address := port.Soap11
+			if version == config.SoapVersion12 {
+				address = port.Soap12
+			}
+			if address != nil {
+				return address.Location
+			}
+		}
+	}
+	return ""
+}
+
+// ApplyOperationBinding fills in the endpoint, SOAP version, binding style and
+// soapAction of a route from its WSDL. Values set in the configuration win.
+func ApplyOperationBinding(route config.RouteConfig) (config.RouteConfig, error) {
+	defaults, err := OperationDefaults(route)
+	if err != nil {
+		return route, err
+	}
+	return route.WithDefaults(defaults), nil
+}
+
+// OperationDefaults returns the endpoint, SOAP version, binding style and
+// soapAction the WSDL of a route declares for its operation, and nothing else
+func OperationDefaults(route config.RouteConfig) (config.RouteConfig, error) {
+	if route.WSDLURL == "" || route.SoapAction == "" {
+		return config.RouteConfig{}, nil
+	}
+
+	binding, err := ExtractOperationBinding(route.WSDLURL, route.SoapAction, route.SoapVersion)
+	if err != nil {
+		return config.RouteConfig{}, err
+	}
+
+	return config.RouteConfig{
+		SoapEndpoint:  binding.Endpoint,
+		SoapVersion:   binding.SoapVersion,
+		SoapActionURI: binding.SoapAction,
+		BindingStyle:  binding.Style,
+	}, nil
+}
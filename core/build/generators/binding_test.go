@@ -0,0 +1,59 @@
+package generators
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rest-to-soap/core/config"
+)
+
+// TestOperationDefaultsAfterLoad checks that a loaded route without a
+// soap_version takes the version of the only binding of its WSDL
+func TestOperationDefaultsAfterLoad(t *testing.T) {
+	wsdl, err := filepath.Abs("testdata/soap12.wsdl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := "routes:\n" +
+		"  - path: /api/countries/{iso}/flag\n" +
+		"    method: GET\n" +
+		"    request_template: request.tmpl\n" +
+		"    wsdl_url: " + wsdl + "\n" +
+		"    soap_action: CountryFlag\n"
+	if err := os.WriteFile(path, []byte(cfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, load := range map[string]func(string) (*config.Config, error){
+		"Load":           config.Load,
+		"LoadUnresolved": config.LoadUnresolved,
+	} {
+		t.Run(name, func(t *testing.T) {
+			loaded, err := load(path)
+			if err != nil {
+				t.Fatalf("%s() error = %v", name, err)
+			}
+			route := loaded.Routes[0]
+			if route.SoapVersion != "" {
+				t.Fatalf("soap_version = %q after %s, want it unset", route.SoapVersion, name)
+			}
+
+			defaults, err := OperationDefaults(route)
+			if err != nil {
+				t.Fatalf("OperationDefaults() error = %v", err)
+			}
+			want := config.RouteConfig{
+				SoapEndpoint:  "http://backend.internal/countryinfo",
+				SoapVersion:   config.SoapVersion12,
+				SoapActionURI: "urn:CountryFlag",
+				BindingStyle:  "document",
+			}
+			if defaults.SoapEndpoint != want.SoapEndpoint || defaults.SoapVersion != want.SoapVersion ||
+				defaults.SoapActionURI != want.SoapActionURI || defaults.BindingStyle != want.BindingStyle {
+				t.Fatalf("OperationDefaults() = %+v, want %+v", defaults, want)
+			}
+		})
+	}
+}
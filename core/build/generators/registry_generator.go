@@ -19,12 +19,18 @@ func NewRegistryGenerator() *RegistryGenerator {
 
 func (g *RegistryGenerator) GenerateRegistry(cfg *config.Config) error {
 	outputPath := filepath.Join(g.outputDir, "route_handler_registry.go")
-	routeHandlers := generateRouteHandlers(cfg)
+	routeHandlers, err := generateRouteHandlers(cfg)
+	if err != nil {
+		return err
+	}
 	generatedCode := fmt.Sprintf(`
 package generated
 
 import (
+	"fmt"
 	"rest-to-soap/core/config"
+	"rest-to-soap/core/schema"
+	"rest-to-soap/core/templating"
 	"text/template"
 	
 	"go.uber.org/zap"
@@ -32,7 +38,9 @@ import (
 
 type GeneratedRouteHandler struct {
 	RouteConfig      config.RouteConfig
-	Parser           func([]byte) (string, error)
+	Parser           func([]byte) (interface{}, error)
+	RequestSchema    *schema.Element
+	ResponseSchema   *schema.Element
 	RequestTemplate  template.Template
 	ResponseTemplate template.Template
 }
@@ -43,47 +51,74 @@ var RouteHandlerRegistry = RouteRegistry{
 	%s
 }
 
-// Hydrate the route registry with the templates
+// Hydrate a new route registry with the configured routes and their templates.
+// The generated registry is only read, so the server can hydrate a new registry
+// on every reload while requests still use the previous one.
 func GenerateRouteRegistry(cfg *config.Config, logger *zap.Logger) (RouteRegistry, error) {
+	registry := make(RouteRegistry, len(cfg.Routes))
 	for _, route := range cfg.Routes {
-		requestTmpl, err := template.ParseFiles(route.RequestTemplate)
+		requestTmpl, err := templating.ParseRequestTemplate(route.RequestTemplate)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("route %%s: %%w", route.Key(), err)
 		}
 
-		responseTmpl, err := template.ParseFiles(route.ResponseTemplate)
-		if err != nil {
-			return nil, err
+		// Routes in auto response mode are rendered without a template
+		responseTmpl := &template.Template{}
+		if route.ResponseTemplate != "" {
+			responseTmpl, err = templating.ParseResponseTemplate(route.ResponseTemplate)
+			if err != nil {
+				return nil, fmt.Errorf("route %%s: %%w", route.Key(), err)
+			}
 		}
 
-		RouteHandlerRegistry[route.Path] = GeneratedRouteHandler{
+		generated := RouteHandlerRegistry[route.Key()]
+
+		// Endpoint, SOAP version and soapAction default to the values read from the WSDL
+		route = route.WithDefaults(generated.RouteConfig)
+
+		registry[route.Key()] = GeneratedRouteHandler{
 			RouteConfig:      route,
-			Parser:           RouteHandlerRegistry[route.Path].Parser,
+			Parser:           generated.Parser,
+			RequestSchema:    generated.RequestSchema,
+			ResponseSchema:   generated.ResponseSchema,
 			RequestTemplate:  *requestTmpl,
 			ResponseTemplate: *responseTmpl,
 		}
 	}
 
-	return RouteHandlerRegistry, nil
+	return registry, nil
 }
 	`, routeHandlers)
 
 	return os.WriteFile(outputPath, []byte(generatedCode), 0644)
 }
 
-func generateRouteHandlers(cfg *config.Config) string {
+func generateRouteHandlers(cfg *config.Config) (string, error) {
 	generatedCode := ""
 
 	for _, route := range cfg.Routes {
+		// Dynamic routes are loaded from their WSDL when the server starts
+		if route.Mode == config.ModeDynamic {
+			continue
+		}
+
+		// Record only the endpoint, binding style and soapAction declared by the
+		// WSDL, the rest of the route comes from the configuration at runtime
+		defaults, err := OperationDefaults(route)
+		if err != nil {
+			return "", fmt.Errorf("failed to read WSDL binding for operation %s: %w", route.SoapAction, err)
+		}
+
 		generatedCode += fmt.Sprintf(`
 			"%s": {
-				RouteConfig: %v,
+				RouteConfig: config.RouteConfig{SoapEndpoint: %q, SoapVersion: %q, SoapActionURI: %q, BindingStyle: %q},
 				Parser:      %sParse,
+				RequestSchema: %sRequestSchema,
 				RequestTemplate: template.Template{},
 				ResponseTemplate: template.Template{},
 			},
-		`, route.Path, fmt.Sprintf("%#v", route), route.SoapAction)
+		`, route.Key(), defaults.SoapEndpoint, defaults.SoapVersion, defaults.SoapActionURI, defaults.BindingStyle, route.SoapAction, route.SoapAction)
 	}
 
-	return generatedCode
+	return generatedCode, nil
 }
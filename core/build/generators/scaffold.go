@@ -0,0 +1,201 @@
+package generators
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"rest-to-soap/core/soapenv"
+)
+
+// maxScaffoldDepth bounds the nesting of scaffolded elements for recursive types
+const maxScaffoldDepth = 8
+
+var templateIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ScaffoldRequestTemplate builds a default request template for an operation from
+// its WSDL input message. The operation element carries the target namespace and
+// every child element reads its value from the JSON body under the same name.
+// The envelope uses the namespace of the given SOAP version.
+func ScaffoldRequestTemplate(wsdlPath, operationName, soapVersion string) (string, error) {
+	wsdl, err := loadWSDL(wsdlPath)
+	if err != nil {
+		return "", err
+	}
+
+	operation, err := findOperation(wsdl, operationName)
+	if err != nil {
+		return "", err
+	}
+
+	requestElement, err := messageElement(wsdl, operation.Input.Message)
+	if err != nil {
+		return "", fmt.Errorf("request element not found for operation %s: %w", operationName, err)
+	}
+
+	typeMap, elementMap := collectSchemaTypes(wsdl)
+	namespace, localName := resolveQName(wsdl, requestElement)
+	if namespace == "" {
+		namespace = elementNamespace(wsdl, localName)
+	}
+
+	scaffold := &requestScaffold{typeMap: typeMap, elementMap: elementMap}
+
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	sb.WriteString(fmt.Sprintf(`<soap:Envelope xmlns:soap="%s">`+"\n", soapenv.Namespace(soapVersion)))
+	sb.WriteString("  <soap:Body>\n")
+
+	// With unqualified local elements only the operation element is in the target namespace
+	openTag, closeTag := localName, localName
+	if qualifiedElements(wsdl, localName) {
+		openTag += fmt.Sprintf(` xmlns="%s"`, namespace)
+	} else {
+		openTag = fmt.Sprintf(`tns:%s xmlns:tns="%s"`, localName, namespace)
+		closeTag = "tns:" + localName
+	}
+	sb.WriteString(fmt.Sprintf("    <%s>\n", openTag))
+	scaffold.writeChildren(&sb, scaffold.elementType(localName), ".body", "      ", 0)
+	sb.WriteString(fmt.Sprintf("    </%s>\n", closeTag))
+
+	sb.WriteString("  </soap:Body>\n")
+	sb.WriteString("</soap:Envelope>\n")
+	return sb.String(), nil
+}
+
+// requestScaffold renders the elements of a request template
+type requestScaffold struct {
+	typeMap    map[string]xsComplexType
+	elementMap map[string]xsElement
+}
+
+// elementType returns the complex type of a top-level element, nil for simple elements
+func (s *requestScaffold) elementType(name string) *xsComplexType {
+	if t, ok := s.typeMap[name]; ok {
+		return &t
+	}
+	if elem, ok := s.elementMap[name]; ok && elem.Type != "" && !isBuiltInType(elem.Type) {
+		if t, ok := s.typeMap[localPart(elem.Type)]; ok {
+			return &t
+		}
+	}
+	return nil
+}
+
+// writeChildren writes the sequence elements of a complex type, reading values from path
+func (s *requestScaffold) writeChildren(sb *strings.Builder, t *xsComplexType, path, indent string, depth int) {
+	if t == nil || t.Sequence == nil || depth > maxScaffoldDepth {
+		return
+	}
+
+	for _, e := range t.Sequence.Elements {
+		name := e.Name
+		fieldType := e.Type
+		if e.Ref != "" {
+			name = localPart(e.Ref)
+			if ref, ok := s.elementMap[name]; ok {
+				fieldType = ref.Type
+			}
+		}
+
+		var childType *xsComplexType
+		switch {
+		case e.ComplexType != nil:
+			childType = e.ComplexType
+		case fieldType != "" && !isBuiltInType(fieldType):
+			if ct, ok := s.typeMap[localPart(fieldType)]; ok {
+				childType = &ct
+			}
+		case e.Ref != "":
+			childType = s.elementType(name)
+		}
+
+		valuePath := templatePath(path, name)
+		innerIndent := indent
+		closeBlock := ""
+		switch {
+		case e.MaxOccurs != "" && e.MaxOccurs != "1":
+			sb.WriteString(fmt.Sprintf("%s{{- range %s }}\n", indent, valuePath))
+			valuePath = "."
+			innerIndent = indent + "  "
+			closeBlock = indent + "{{- end }}\n"
+		case e.MinOccurs == "0":
+			sb.WriteString(fmt.Sprintf("%s{{- with %s }}\n", indent, valuePath))
+			valuePath = "."
+			innerIndent = indent + "  "
+			closeBlock = indent + "{{- end }}\n"
+		}
+
+		if childType != nil && childType.Sequence != nil {
+			sb.WriteString(fmt.Sprintf("%s<%s>\n", innerIndent, name))
+			s.writeChildren(sb, childType, valuePath, innerIndent+"  ", depth+1)
+			sb.WriteString(fmt.Sprintf("%s</%s>\n", innerIndent, name))
+		} else {
+			sb.WriteString(fmt.Sprintf("%s<%s>{{ %s }}</%s>\n", innerIndent, name, valuePath, name))
+		}
+		sb.WriteString(closeBlock)
+	}
+}
+
+// templatePath appends a field to a template data path, using index for names
+// that are not valid template identifiers
+func templatePath(path, name string) string {
+	if !templateIdentifier.MatchString(name) {
+		return fmt.Sprintf("(index %s %q)", path, name)
+	}
+	if path == "." {
+		return "." + name
+	}
+	return path + "." + name
+}
+
+// resolveQName resolves a prefixed name such as `tns:CountryFlag` against the
+// namespace declarations of the WSDL definitions element
+func resolveQName(wsdl *wsdlDefinitions, qname string) (string, string) {
+	prefix, local := "", qname
+	if idx := strings.Index(qname, ":"); idx != -1 {
+		prefix, local = qname[:idx], qname[idx+1:]
+	}
+
+	for _, attr := range wsdl.Namespaces {
+		if prefix == "" && attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+			return attr.Value, local
+		}
+		if prefix != "" && attr.Name.Space == "xmlns" && attr.Name.Local == prefix {
+			return attr.Value, local
+		}
+	}
+	return "", local
+}
+
+// elementNamespace returns the target namespace of the schema declaring a top-level element
+func elementNamespace(wsdl *wsdlDefinitions, name string) string {
+	for _, schema := range wsdl.Types.Schemas {
+		for _, e := range schema.Elements {
+			if e.Name == name {
+				return schema.TargetNS
+			}
+		}
+	}
+	return wsdl.TargetNS
+}
+
+// qualifiedElements reports whether the schema declaring a top-level element
+// qualifies its local elements with the target namespace
+func qualifiedElements(wsdl *wsdlDefinitions, name string) bool {
+	for _, schema := range wsdl.Types.Schemas {
+		for _, e := range schema.Elements {
+			if e.Name == name {
+				return schema.ElementFormDefault == "qualified"
+			}
+		}
+	}
+	return true
+}
+
+func localPart(qname string) string {
+	if idx := strings.Index(qname, ":"); idx != -1 {
+		return qname[idx+1:]
+	}
+	return qname
+}
@@ -0,0 +1,192 @@
+package generators
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"rest-to-soap/core/schema"
+)
+
+// maxSchemaDepth bounds the nesting of the validation model for recursive types
+const maxSchemaDepth = 16
+
+// ExtractRequestSchema builds the validation model of the request element of a WSDL operation
+func ExtractRequestSchema(wsdlPath, operationName string) (*schema.Element, error) {
+	return extractMessageSchema(wsdlPath, operationName, false)
+}
+
+// ExtractResponseSchema builds the model of the response element of a WSDL operation
+func ExtractResponseSchema(wsdlPath, operationName string) (*schema.Element, error) {
+	return extractMessageSchema(wsdlPath, operationName, true)
+}
+
+func extractMessageSchema(wsdlPath, operationName string, output bool) (*schema.Element, error) {
+	wsdl, err := loadWSDL(wsdlPath)
+	if err != nil {
+		return nil, err
+	}
+
+	operation, err := findOperation(wsdl, operationName)
+	if err != nil {
+		return nil, err
+	}
+
+	kind, message := "request", operation.Input.Message
+	if output {
+		kind, message = "response", operation.Output.Message
+	}
+
+	rootElement, err := messageElement(wsdl, message)
+	if err != nil {
+		return nil, fmt.Errorf("%s element not found for operation %s: %w", kind, operationName, err)
+	}
+
+	typeMap, elementMap := collectSchemaTypes(wsdl)
+	builder := &schemaBuilder{
+		typeMap:     typeMap,
+		elementMap:  elementMap,
+		simpleTypes: collectSimpleTypes(wsdl),
+	}
+
+	name := localPart(rootElement)
+	elem, ok := elementMap[name]
+	if !ok {
+		return nil, fmt.Errorf("%s element %s not found in schema", kind, name)
+	}
+	return builder.element(elem, 0), nil
+}
+
+// schemaBuilder converts XSD declarations into the validation model
+type schemaBuilder struct {
+	typeMap     map[string]xsComplexType
+	elementMap  map[string]xsElement
+	simpleTypes map[string]xsSimpleType
+}
+
+func (b *schemaBuilder) element(e xsElement, depth int) *schema.Element {
+	name := e.Name
+	typeName := e.Type
+	if e.Ref != "" {
+		name = localPart(e.Ref)
+		if ref, ok := b.elementMap[name]; ok {
+			typeName = ref.Type
+			if ref.ComplexType != nil && e.ComplexType == nil {
+				e.ComplexType = ref.ComplexType
+			}
+		}
+	}
+
+	out := &schema.Element{
+		Name:      name,
+		MinOccurs: parseOccurs(e.MinOccurs),
+		MaxOccurs: parseOccurs(e.MaxOccurs),
+	}
+	if depth > maxSchemaDepth {
+		return out
+	}
+
+	switch {
+	case e.ComplexType != nil:
+		out.Children = b.children(e.ComplexType, depth)
+	case typeName == "":
+		out.Type = "string"
+	case isBuiltInType(typeName):
+		out.Type = localPart(typeName)
+	default:
+		if t, ok := b.typeMap[localPart(typeName)]; ok {
+			out.Children = b.children(&t, depth)
+			if t.SimpleContent != nil {
+				out.Type = localPart(t.SimpleContent.Extension.Base)
+			}
+		} else {
+			out.Type, out.Enum = b.simpleType(typeName, 0)
+		}
+	}
+	return out
+}
+
+func (b *schemaBuilder) children(t *xsComplexType, depth int) []*schema.Element {
+	if t.Sequence == nil {
+		return nil
+	}
+	children := make([]*schema.Element, 0, len(t.Sequence.Elements))
+	for _, e := range t.Sequence.Elements {
+		children = append(children, b.element(e, depth+1))
+	}
+	return children
+}
+
+// simpleType resolves a simple type to its built-in base type and enumeration values
+func (b *schemaBuilder) simpleType(typeName string, depth int) (string, []string) {
+	if isBuiltInType(typeName) {
+		return localPart(typeName), nil
+	}
+	st, ok := b.simpleTypes[localPart(typeName)]
+	if !ok || depth > maxSchemaDepth {
+		return "string", nil
+	}
+
+	base, enums := b.simpleType(st.Restriction.Base, depth+1)
+	if len(st.Restriction.Enums) > 0 {
+		enums = make([]string, 0, len(st.Restriction.Enums))
+		for _, enum := range st.Restriction.Enums {
+			enums = append(enums, enum.Value)
+		}
+	}
+	return base, enums
+}
+
+// collectSimpleTypes builds the simple type map from all schemas of the WSDL
+func collectSimpleTypes(wsdl *wsdlDefinitions) map[string]xsSimpleType {
+	simpleTypes := make(map[string]xsSimpleType)
+	for _, s := range wsdl.Types.Schemas {
+		for _, t := range s.SimpleTypes {
+			simpleTypes[t.Name] = t
+		}
+	}
+	return simpleTypes
+}
+
+// parseOccurs converts a minOccurs/maxOccurs attribute, both default to 1
+func parseOccurs(value string) int {
+	switch value {
+	case "":
+		return 1
+	case "unbounded":
+		return schema.Unbounded
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 1
+	}
+	return n
+}
+
+// schemaLiteral renders the validation model as a Go composite literal
+func schemaLiteral(e *schema.Element, indent string) string {
+	var sb strings.Builder
+	writeSchemaFields(&sb, e, indent+"\t")
+	return "&schema.Element{\n" + sb.String() + indent + "}"
+}
+
+func writeSchemaFields(sb *strings.Builder, e *schema.Element, indent string) {
+	sb.WriteString(fmt.Sprintf("%sName:      %q,\n", indent, e.Name))
+	if e.Type != "" {
+		sb.WriteString(fmt.Sprintf("%sType:      %q,\n", indent, e.Type))
+	}
+	sb.WriteString(fmt.Sprintf("%sMinOccurs: %d,\n", indent, e.MinOccurs))
+	sb.WriteString(fmt.Sprintf("%sMaxOccurs: %d,\n", indent, e.MaxOccurs))
+	if len(e.Enum) > 0 {
+		sb.WriteString(fmt.Sprintf("%sEnum:      %#v,\n", indent, e.Enum))
+	}
+	if len(e.Children) > 0 {
+		sb.WriteString(indent + "Children: []*schema.Element{\n")
+		for _, child := range e.Children {
+			sb.WriteString(indent + "\t{\n")
+			writeSchemaFields(sb, child, indent+"\t\t")
+			sb.WriteString(indent + "\t},\n")
+		}
+		sb.WriteString(indent + "},\n")
+	}
+}
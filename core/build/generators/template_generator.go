@@ -38,22 +38,48 @@ func (g *TemplateGenerator) GenerateTemplates(cfg *config.Config) error {
 			continue // Skip if no SOAPAction is defined
 		}
 
-		// Generate the template
-		if err := g.generateTemplate(route.WSDLURL, operationName, route.ResponseTemplate); err != nil {
-			return fmt.Errorf("failed to generate template for operation %s: %w", operationName, err)
+		// Scaffolding follows the SOAP version of the WSDL binding unless the route sets one
+		route, err := ApplyOperationBinding(route)
+		if err != nil {
+			return fmt.Errorf("failed to read WSDL binding for operation %s: %w", operationName, err)
+		}
+
+		// Generate the parser, dynamic routes parse responses without generated code
+		if route.Mode != config.ModeDynamic {
+			if err := g.generateTemplate(route.WSDLURL, operationName); err != nil {
+				return fmt.Errorf("failed to generate template for operation %s: %w", operationName, err)
+			}
+		}
+
+		// Scaffold the request template unless a hand-written one already exists
+		if route.RequestTemplate != "" {
+			if _, err := os.Stat(route.RequestTemplate); os.IsNotExist(err) {
+				if route.BindingStyle == "rpc" {
+					fmt.Printf("Operation %s uses the rpc binding style, the scaffolded template assumes document/literal\n", operationName)
+				}
+				if err := g.scaffoldRequestTemplate(route.WSDLURL, operationName, route.EnvelopeVersion(), route.RequestTemplate); err != nil {
+					return fmt.Errorf("failed to scaffold request template for operation %s: %w", operationName, err)
+				}
+			}
 		}
 	}
 	return nil
 }
 
-// generateTemplate generates a Go template for a specific WSDL operation
-func (g *TemplateGenerator) generateTemplate(wsdlURL, operationName, templatePath string) error {
+// generateTemplate generates the response types and parser for a specific WSDL operation
+func (g *TemplateGenerator) generateTemplate(wsdlURL, operationName string) error {
 	// Generate structs from WSDL
-	structs, responseType, err := ExtractStructsFromWSDL(wsdlURL, operationName)
+	structs, _, responseType, err := ExtractStructsFromWSDL(wsdlURL, operationName)
 	if err != nil {
 		return fmt.Errorf("failed to extract structs: %w", err)
 	}
 
+	// Build the validation model of the request element
+	requestSchema, err := ExtractRequestSchema(wsdlURL, operationName)
+	if err != nil {
+		return fmt.Errorf("failed to extract request schema: %w", err)
+	}
+
 	// Create the output file
 	outputPath := filepath.Join(g.outputDir, fmt.Sprintf("%s_parser.go", operationName))
 
@@ -62,19 +88,21 @@ func (g *TemplateGenerator) generateTemplate(wsdlURL, operationName, templatePat
 		`package generated
 
 import (
-	"bytes"
 	"encoding/xml"
 	"fmt"
-	"text/template"
+	"rest-to-soap/core/schema"
+	"rest-to-soap/core/soapenv"
 )
 
 %s
 
-// %sParser parses the SOAP response for the %s operation
-func %sParse(xmlData []byte) (string, error) {
-	fmt.Println(string(xmlData))
+// %sRequestSchema describes the %s request element, used to validate JSON requests
+var %sRequestSchema = %s
 
-	// Define the SOAP envelope structure with the proper response type
+// %sParse parses the SOAP response for the %s operation into its typed response element
+func %sParse(xmlData []byte) (interface{}, error) {
+	// Define the SOAP envelope structure with the proper response type, the
+	// envelope namespace is checked below so SOAP 1.1 and 1.2 are both accepted
 	var response struct {
 		XMLName xml.Name %s
 		Body    struct {
@@ -84,31 +112,27 @@ func %sParse(xmlData []byte) (string, error) {
 
 	// Unmarshal the XML into our strongly-typed struct
 	if err := xml.Unmarshal(xmlData, &response); err != nil {
-		return "", fmt.Errorf("failed to unmarshal XML: %%w", err)
+		return nil, fmt.Errorf("failed to unmarshal XML: %%w", err)
 	}
-
-	// Parse and execute the template
-	tmpl, err := template.ParseFiles("%s")
-	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %%w", err)
+	if !soapenv.IsEnvelopeNamespace(response.XMLName.Space) {
+		return nil, fmt.Errorf("unexpected SOAP envelope namespace %%q", response.XMLName.Space)
 	}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, response.Body.Response); err != nil {
-		return "", fmt.Errorf("failed to execute template: %%w", err)
-	}
-	return buf.String(), nil
+	return response.Body.Response, nil
 }
 `,
 		structs,
 		operationName,
 		operationName,
 		operationName,
-		"`xml:\"http://schemas.xmlsoap.org/soap/envelope/ Envelope\"`",
+		schemaLiteral(requestSchema, ""),
+		operationName,
+		operationName,
+		operationName,
+		"`xml:\"Envelope\"`",
 		responseType,
 		fmt.Sprintf("`xml:\"%s\"`", responseType),
-		"`xml:\"http://schemas.xmlsoap.org/soap/envelope/ Body\"`",
-		templatePath,
+		"`xml:\"Body\"`",
 	)
 
 	// Create or update the file
@@ -124,3 +148,22 @@ func %sParse(xmlData []byte) (string, error) {
 
 	return nil
 }
+
+// scaffoldRequestTemplate writes a default request template for a WSDL operation
+func (g *TemplateGenerator) scaffoldRequestTemplate(wsdlURL, operationName, soapVersion, templatePath string) error {
+	tmpl, err := ScaffoldRequestTemplate(wsdlURL, operationName, soapVersion)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(templatePath), 0755); err != nil {
+		return fmt.Errorf("failed to create template directory: %w", err)
+	}
+
+	if err := os.WriteFile(templatePath, []byte(tmpl), 0644); err != nil {
+		return fmt.Errorf("failed to write request template: %w", err)
+	}
+
+	fmt.Printf("Scaffolded request template %s for operation %s\n", templatePath, operationName)
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,14 +16,18 @@ import (
 // Only the fields we need for struct extraction are included
 
 type wsdlDefinitions struct {
-	XMLName xml.Name `xml:"definitions"`
-	Types   struct {
+	XMLName    xml.Name   `xml:"definitions"`
+	TargetNS   string     `xml:"targetNamespace,attr"`
+	Namespaces []xml.Attr `xml:",any,attr"`
+	Types      struct {
 		Schemas []xsSchema `xml:"schema"`
 	} `xml:"types"`
 	Messages []wsdlMessage `xml:"message"`
 	PortType struct {
 		Operations []wsdlOperation `xml:"operation"`
 	} `xml:"portType"`
+	Bindings []wsdlBinding `xml:"binding"`
+	Services []wsdlService `xml:"service"`
 }
 
 type wsdlMessage struct {
@@ -45,12 +50,13 @@ type wsdlOperation struct {
 }
 
 type xsSchema struct {
-	XMLName      xml.Name        `xml:"schema"`
-	TargetNS     string          `xml:"targetNamespace,attr"`
-	ComplexTypes []xsComplexType `xml:"complexType"`
-	SimpleTypes  []xsSimpleType  `xml:"simpleType"`
-	Elements     []xsElement     `xml:"element"`
-	Imports      []xsImport      `xml:"import"`
+	XMLName            xml.Name        `xml:"schema"`
+	TargetNS           string          `xml:"targetNamespace,attr"`
+	ElementFormDefault string          `xml:"elementFormDefault,attr"`
+	ComplexTypes       []xsComplexType `xml:"complexType"`
+	SimpleTypes        []xsSimpleType  `xml:"simpleType"`
+	Elements           []xsElement     `xml:"element"`
+	Imports            []xsImport      `xml:"import"`
 }
 
 type xsImport struct {
@@ -104,9 +110,105 @@ type xsAttribute struct {
 	Use  string `xml:"use,attr"`
 }
 
-// ExtractStructsFromWSDL parses the WSDL and returns Go struct definitions for the specified endpoint
-func ExtractStructsFromWSDL(wsdlPath, endpointName string) (string, string, error) {
-	fmt.Printf("Reading WSDL file: %s\n", wsdlPath)
+// ExtractStructsFromWSDL parses the WSDL and returns Go struct definitions for the
+// request and response elements of the specified endpoint, along with their Go type names
+func ExtractStructsFromWSDL(wsdlPath, endpointName string) (string, string, string, error) {
+	wsdl, err := loadWSDL(wsdlPath)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	// Find the operation
+	operation, err := findOperation(wsdl, endpointName)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	// Get the request and response element types
+	requestType, err := messageElement(wsdl, operation.Input.Message)
+	if err != nil {
+		return "", "", "", fmt.Errorf("request type not found for endpoint %s: %w", endpointName, err)
+	}
+	debugf("Found request type: %s\n", requestType)
+
+	responseType, err := messageElement(wsdl, operation.Output.Message)
+	if err != nil {
+		return "", "", "", fmt.Errorf("response type not found for endpoint %s: %w", endpointName, err)
+	}
+	debugf("Found response type: %s\n", responseType)
+
+	// Build type and element maps from all schemas
+	typeMap, elementMap := collectSchemaTypes(wsdl)
+
+	// Generate structs recursively, for the request and the response
+	structs := make(map[string]string)
+	visited := make(map[string]bool)
+	for _, rootType := range []string{requestType, responseType} {
+		debugf("Starting recursive struct generation for type: %s\n", rootType)
+		if err := buildStructsRecursive(typeMap, elementMap, rootType, structs, visited, ""); err != nil {
+			return "", "", "", fmt.Errorf("failed to build structs for %s: %w", rootType, err)
+		}
+	}
+
+	// Also build structs for all complex types in the typeMap
+	debugf("\nBuilding structs for all complex types:\n")
+	for name := range typeMap {
+		if !visited[name] {
+			debugf("Building struct for complex type: %s\n", name)
+			if err := buildStructsRecursive(typeMap, elementMap, name, structs, visited, ""); err != nil {
+				return "", "", "", fmt.Errorf("failed to build struct for complex type %s: %w", name, err)
+			}
+		}
+	}
+
+	// Combine all structs
+	var out strings.Builder
+	debugf("Generated %d structs:\n", len(structs))
+	for name, s := range structs {
+		debugf("Struct: %s\n%s\n", name, s)
+		out.WriteString(s + "\n\n")
+	}
+
+	return out.String(), GoTypeName(requestType), GoTypeName(responseType), nil
+}
+
+// Verbose enables the trace of WSDL parsing and struct generation on stdout.
+// The build command turns it on, the server keeps it off when it loads WSDLs
+// for routes in dynamic mode.
+var Verbose bool
+
+func debugf(format string, args ...interface{}) {
+	if Verbose {
+		fmt.Printf(format, args...)
+	}
+}
+
+// wsdlCache keeps parsed WSDLs so that every generator reads a WSDL only once.
+// The server uses it from reloads and dynamic routes concurrently, cached
+// definitions are never modified.
+var (
+	wsdlCacheMu sync.Mutex
+	wsdlCache   = make(map[string]*wsdlDefinitions)
+)
+
+// ClearWSDLCache drops the parsed WSDLs so that they are read again
+func ClearWSDLCache() {
+	wsdlCacheMu.Lock()
+	defer wsdlCacheMu.Unlock()
+	wsdlCache = make(map[string]*wsdlDefinitions)
+}
+
+// loadWSDL reads and parses a WSDL from a local file or an HTTP URL, merging
+// local XSD imports. The lock is not held while reading, concurrent loads of
+// the same WSDL may both read it.
+func loadWSDL(wsdlPath string) (*wsdlDefinitions, error) {
+	wsdlCacheMu.Lock()
+	cached, ok := wsdlCache[wsdlPath]
+	wsdlCacheMu.Unlock()
+	if ok {
+		return cached, nil
+	}
+	debugf("Reading WSDL file: %s\n", wsdlPath)
 
 	// Read WSDL content
 	var data []byte
@@ -120,107 +222,66 @@ func ExtractStructsFromWSDL(wsdlPath, endpointName string) (string, string, erro
 		}
 		resp, err := client.Get(wsdlPath)
 		if err != nil {
-			return "", "", fmt.Errorf("failed to fetch WSDL from URL: %w", err)
+			return nil, fmt.Errorf("failed to fetch WSDL from URL: %w", err)
 		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			return "", "", fmt.Errorf("failed to fetch WSDL: HTTP %d", resp.StatusCode)
+			return nil, fmt.Errorf("failed to fetch WSDL: HTTP %d", resp.StatusCode)
 		}
 
 		data, err = io.ReadAll(resp.Body)
 		if err != nil {
-			return "", "", fmt.Errorf("failed to read WSDL response: %w", err)
+			return nil, fmt.Errorf("failed to read WSDL response: %w", err)
 		}
 	} else {
 		// Handle local files
 		data, err = os.ReadFile(wsdlPath)
 		if err != nil {
-			return "", "", fmt.Errorf("failed to read WSDL file: %w", err)
+			return nil, fmt.Errorf("failed to read WSDL file: %w", err)
 		}
 		// Get base directory for resolving relative imports
 		baseDir = filepath.Dir(wsdlPath)
 	}
 
-	fmt.Printf("Successfully read WSDL file (%d bytes)\n", len(data))
+	debugf("Successfully read WSDL file (%d bytes)\n", len(data))
 
 	var wsdl wsdlDefinitions
 	if err := xml.Unmarshal(data, &wsdl); err != nil {
-		return "", "", fmt.Errorf("failed to parse WSDL: %w", err)
+		return nil, fmt.Errorf("failed to parse WSDL: %w", err)
 	}
-	fmt.Printf("Successfully parsed WSDL\n")
+	debugf("Successfully parsed WSDL\n")
 
 	// Process XSD imports if we have a base directory (local files)
 	if baseDir != "" {
 		if err := processXSDImports(&wsdl, baseDir); err != nil {
-			return "", "", fmt.Errorf("failed to process XSD imports: %w", err)
+			return nil, fmt.Errorf("failed to process XSD imports: %w", err)
 		}
 	}
 
-	// Find the operation
-	fmt.Printf("Looking for endpoint: %s\n", endpointName)
-	var operation wsdlOperation
-	for _, op := range wsdl.PortType.Operations {
-		fmt.Printf("Found operation: %s\n", op.Name)
-		if op.Name == endpointName {
-			operation = op
-			break
-		}
-	}
-	if operation.Name == "" {
-		return "", "", fmt.Errorf("endpoint %s not found", endpointName)
-	}
-	fmt.Printf("Found matching operation: %s\n", operation.Name)
-
-	// Find the output message
-	outputMsgName := operation.Output.Message
-	if idx := strings.Index(outputMsgName, ":"); idx != -1 {
-		outputMsgName = outputMsgName[idx+1:]
-	}
-	fmt.Printf("Looking for output message: %s\n", outputMsgName)
-	var outputMessage wsdlMessage
-	for _, msg := range wsdl.Messages {
-		fmt.Printf("Found message: %s\n", msg.Name)
-		if msg.Name == outputMsgName {
-			outputMessage = msg
-			break
-		}
-	}
-	if outputMessage.Name == "" {
-		return "", "", fmt.Errorf("output message not found for endpoint %s", endpointName)
-	}
-	fmt.Printf("Found matching message: %s\n", outputMessage.Name)
-
-	// Get the response element type
-	var responseType string
-	for _, part := range outputMessage.Parts {
-		fmt.Printf("Message part - Name: %s, Type: %s, Elem: %s\n", part.Name, part.Type, part.Elem)
-		if part.Elem != "" {
-			responseType = part.Elem
-			break
-		}
-	}
-	if responseType == "" {
-		return "", "", fmt.Errorf("response type not found for endpoint %s", endpointName)
-	}
-	fmt.Printf("Found response type: %s\n", responseType)
+	wsdlCacheMu.Lock()
+	wsdlCache[wsdlPath] = &wsdl
+	wsdlCacheMu.Unlock()
+	return &wsdl, nil
+}
 
-	// Build type and element maps from all schemas
+// collectSchemaTypes builds the complex type and element maps from all schemas of the WSDL
+func collectSchemaTypes(wsdl *wsdlDefinitions) (map[string]xsComplexType, map[string]xsElement) {
 	typeMap := make(map[string]xsComplexType)
 	elementMap := make(map[string]xsElement)
 	for _, schema := range wsdl.Types.Schemas {
-		fmt.Printf("Processing schema with target namespace: %s\n", schema.TargetNS)
+		debugf("Processing schema with target namespace: %s\n", schema.TargetNS)
 		for _, t := range schema.ComplexTypes {
-			fmt.Printf("Found complex type: %s\n", t.Name)
+			debugf("Found complex type: %s\n", t.Name)
 			typeMap[t.Name] = t
 		}
 		for _, e := range schema.Elements {
-			fmt.Printf("Found element: %s (type: %s, ref: %s, minOccurs: %s, maxOccurs: %s)\n",
+			debugf("Found element: %s (type: %s, ref: %s, minOccurs: %s, maxOccurs: %s)\n",
 				e.Name, e.Type, e.Ref, e.MinOccurs, e.MaxOccurs)
 
 			// If element has an inline complex type, add it to typeMap
 			if e.ComplexType != nil {
-				fmt.Printf("Element %s has inline complex type\n", e.Name)
+				debugf("Element %s has inline complex type\n", e.Name)
 				e.ComplexType.Name = e.Name
 				typeMap[e.Name] = *e.ComplexType
 			}
@@ -230,68 +291,76 @@ func ExtractStructsFromWSDL(wsdlPath, endpointName string) (string, string, erro
 	}
 
 	// Print all elements and their types for debugging
-	fmt.Printf("\nAll elements in elementMap:\n")
+	debugf("\nAll elements in elementMap:\n")
 	for name, elem := range elementMap {
-		fmt.Printf("Element: %s\n", name)
-		fmt.Printf("  Type: %s\n", elem.Type)
-		fmt.Printf("  Ref: %s\n", elem.Ref)
-		fmt.Printf("  MinOccurs: %s\n", elem.MinOccurs)
-		fmt.Printf("  MaxOccurs: %s\n", elem.MaxOccurs)
+		debugf("Element: %s\n", name)
+		debugf("  Type: %s\n", elem.Type)
+		debugf("  Ref: %s\n", elem.Ref)
+		debugf("  MinOccurs: %s\n", elem.MinOccurs)
+		debugf("  MaxOccurs: %s\n", elem.MaxOccurs)
 		if elem.ComplexType != nil {
-			fmt.Printf("  Has inline complex type\n")
+			debugf("  Has inline complex type\n")
 		}
 	}
 
 	// Print all complex types for debugging
-	fmt.Printf("\nAll complex types in typeMap:\n")
+	debugf("\nAll complex types in typeMap:\n")
 	for name, t := range typeMap {
-		fmt.Printf("Complex Type: %s\n", name)
+		debugf("Complex Type: %s\n", name)
 		if t.Sequence != nil {
-			fmt.Printf("  Has sequence with %d elements\n", len(t.Sequence.Elements))
+			debugf("  Has sequence with %d elements\n", len(t.Sequence.Elements))
 			for _, e := range t.Sequence.Elements {
-				fmt.Printf("    Element: %s (type: %s, minOccurs: %s, maxOccurs: %s)\n",
+				debugf("    Element: %s (type: %s, minOccurs: %s, maxOccurs: %s)\n",
 					e.Name, e.Type, e.MinOccurs, e.MaxOccurs)
 			}
 		}
 		if len(t.Attributes) > 0 {
-			fmt.Printf("  Has %d attributes\n", len(t.Attributes))
+			debugf("  Has %d attributes\n", len(t.Attributes))
 			for _, attr := range t.Attributes {
-				fmt.Printf("    Attribute: %s (type: %s)\n", attr.Name, attr.Type)
+				debugf("    Attribute: %s (type: %s)\n", attr.Name, attr.Type)
 			}
 		}
 		if t.SimpleContent != nil {
-			fmt.Printf("  Has simple content with base: %s\n", t.SimpleContent.Extension.Base)
+			debugf("  Has simple content with base: %s\n", t.SimpleContent.Extension.Base)
 		}
 	}
 
-	// Generate structs recursively
-	structs := make(map[string]string)
-	visited := make(map[string]bool)
-	fmt.Printf("Starting recursive struct generation for type: %s\n", responseType)
-	if err := buildStructsRecursive(typeMap, elementMap, responseType, structs, visited, ""); err != nil {
-		return "", responseType, fmt.Errorf("failed to build structs: %w", err)
-	}
+	return typeMap, elementMap
+}
 
-	// Also build structs for all complex types in the typeMap
-	fmt.Printf("\nBuilding structs for all complex types:\n")
-	for name := range typeMap {
-		if !visited[name] {
-			fmt.Printf("Building struct for complex type: %s\n", name)
-			if err := buildStructsRecursive(typeMap, elementMap, name, structs, visited, ""); err != nil {
-				return "", responseType, fmt.Errorf("failed to build struct for complex type %s: %w", name, err)
-			}
+// findOperation looks up an operation of the WSDL port type by name
+func findOperation(wsdl *wsdlDefinitions, endpointName string) (wsdlOperation, error) {
+	debugf("Looking for endpoint: %s\n", endpointName)
+	for _, op := range wsdl.PortType.Operations {
+		debugf("Found operation: %s\n", op.Name)
+		if op.Name == endpointName {
+			debugf("Found matching operation: %s\n", op.Name)
+			return op, nil
 		}
 	}
+	return wsdlOperation{}, fmt.Errorf("endpoint %s not found", endpointName)
+}
 
-	// Combine all structs
-	var out strings.Builder
-	fmt.Printf("Generated %d structs:\n", len(structs))
-	for name, s := range structs {
-		fmt.Printf("Struct: %s\n%s\n", name, s)
-		out.WriteString(s + "\n\n")
+// messageElement returns the element referenced by the first element part of a message
+func messageElement(wsdl *wsdlDefinitions, messageName string) (string, error) {
+	if idx := strings.Index(messageName, ":"); idx != -1 {
+		messageName = messageName[idx+1:]
 	}
+	debugf("Looking for message: %s\n", messageName)
 
-	return out.String(), GoTypeName(responseType), nil
+	for _, msg := range wsdl.Messages {
+		if msg.Name != messageName {
+			continue
+		}
+		for _, part := range msg.Parts {
+			debugf("Message part - Name: %s, Type: %s, Elem: %s\n", part.Name, part.Type, part.Elem)
+			if part.Elem != "" {
+				return part.Elem, nil
+			}
+		}
+		return "", fmt.Errorf("message %s has no element part", messageName)
+	}
+	return "", fmt.Errorf("message %s not found", messageName)
 }
 
 // buildStructsRecursive generates Go structs for the given type/element name recursively
@@ -301,16 +370,16 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 	if idx := strings.Index(baseTypeName, ":"); idx != -1 {
 		baseTypeName = baseTypeName[idx+1:]
 	}
-	fmt.Printf("Building struct for type: %s (base name: %s)\n", typeName, baseTypeName)
+	debugf("Building struct for type: %s (base name: %s)\n", typeName, baseTypeName)
 
 	if baseTypeName == "" {
-		fmt.Printf("Empty type name, skipping\n")
+		debugf("Empty type name, skipping\n")
 		return nil
 	}
 
 	// Check if it's a built-in type first
 	if isBuiltInType(typeName) {
-		fmt.Printf("Type %s is a built-in XSD type, skipping struct generation\n", typeName)
+		debugf("Type %s is a built-in XSD type, skipping struct generation\n", typeName)
 		return nil
 	}
 
@@ -319,7 +388,7 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 		// Only mark as visited if we're actually going to process it
 		if !visited[baseTypeName] {
 			visited[baseTypeName] = true
-			fmt.Printf("Found complex type definition for %s\n", baseTypeName)
+			debugf("Found complex type definition for %s\n", baseTypeName)
 
 			var sb strings.Builder
 			structName := GoTypeName(baseTypeName)
@@ -327,7 +396,7 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 
 			// Handle sequence elements
 			if t.Sequence != nil {
-				fmt.Printf("Processing sequence with %d elements\n", len(t.Sequence.Elements))
+				debugf("Processing sequence with %d elements\n", len(t.Sequence.Elements))
 				for _, e := range t.Sequence.Elements {
 					// Get the actual type, handling both direct types and references
 					fieldType := e.Type
@@ -356,29 +425,29 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 						goType = "[]" + goType
 					}
 
-					fmt.Printf("Adding sequence element %s of type %s (Go type: %s)\n", e.Name, fieldType, goType)
-					sb.WriteString("\t" + goFieldName(e.Name) + " " + goType + " `xml:\"" + e.Name + "\"`\n")
+					debugf("Adding sequence element %s of type %s (Go type: %s)\n", e.Name, fieldType, goType)
+					sb.WriteString("\t" + goFieldName(e.Name) + " " + goType + " " + elementTag(e) + "\n")
 				}
 			}
 
 			// Handle attributes
 			if len(t.Attributes) > 0 {
-				fmt.Printf("Processing %d attributes\n", len(t.Attributes))
+				debugf("Processing %d attributes\n", len(t.Attributes))
 				for _, attr := range t.Attributes {
 					fieldType := GoTypeName(attr.Type)
-					fmt.Printf("Adding attribute %s of type %s\n", attr.Name, fieldType)
+					debugf("Adding attribute %s of type %s\n", attr.Name, fieldType)
 					sb.WriteString("\t" + goFieldName(attr.Name) + " " + fieldType + " `xml:\"" + attr.Name + ",attr\"`\n")
 				}
 			}
 
 			// Handle simple content
 			if t.SimpleContent != nil {
-				fmt.Printf("Processing simple content with base type %s\n", t.SimpleContent.Extension.Base)
+				debugf("Processing simple content with base type %s\n", t.SimpleContent.Extension.Base)
 				baseType := GoTypeName(t.SimpleContent.Extension.Base)
 				sb.WriteString("\tValue " + baseType + " `xml:\",chardata\"`\n")
 				for _, attr := range t.SimpleContent.Extension.Attributes {
 					fieldType := GoTypeName(attr.Type)
-					fmt.Printf("Adding simple content attribute %s of type %s\n", attr.Name, fieldType)
+					debugf("Adding simple content attribute %s of type %s\n", attr.Name, fieldType)
 					sb.WriteString("\t" + goFieldName(attr.Name) + " " + fieldType + " `xml:\"" + attr.Name + ",attr\"`\n")
 				}
 			}
@@ -391,10 +460,10 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 
 	// If not a complex type, check if it's an element
 	if elem, ok := elementMap[baseTypeName]; ok {
-		fmt.Printf("Found element definition for %s\n", baseTypeName)
+		debugf("Found element definition for %s\n", baseTypeName)
 		// If the element has a type, use that
 		if elem.Type != "" {
-			fmt.Printf("Element has type: %s\n", elem.Type)
+			debugf("Element has type: %s\n", elem.Type)
 			// Process the element's type first if it's not a built-in type
 			if !isBuiltInType(elem.Type) {
 				if err := buildStructsRecursive(typeMap, elementMap, elem.Type, structs, visited, elem.Name); err != nil {
@@ -412,8 +481,8 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 			if elem.MaxOccurs != "" && elem.MaxOccurs != "1" {
 				fieldType = "[]" + fieldType
 			}
-			fmt.Printf("Adding field %s of type %s\n", elem.Name, fieldType)
-			sb.WriteString("\t" + goFieldName(elem.Name) + " " + fieldType + " `xml:\"" + elem.Name + "\"`\n")
+			debugf("Adding field %s of type %s\n", elem.Name, fieldType)
+			sb.WriteString("\t" + goFieldName(elem.Name) + " " + fieldType + " " + elementTag(elem) + "\n")
 
 			sb.WriteString("}")
 			structs[structName] = sb.String()
@@ -422,7 +491,7 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 
 		// If the element references another element
 		if elem.Ref != "" {
-			fmt.Printf("Element references another element: %s\n", elem.Ref)
+			debugf("Element references another element: %s\n", elem.Ref)
 			refName := elem.Ref
 			if idx := strings.Index(refName, ":"); idx != -1 {
 				refName = refName[idx+1:]
@@ -431,7 +500,7 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 		}
 
 		// If the element has no type or ref, look for its complex type definition
-		fmt.Printf("Element has no type or ref, looking for complex type definition\n")
+		debugf("Element has no type or ref, looking for complex type definition\n")
 		var sb strings.Builder
 		structName := GoTypeName(baseTypeName)
 		sb.WriteString("type " + structName + " struct {\n")
@@ -441,10 +510,10 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 		for _, t := range typeMap {
 			if t.Name == baseTypeName {
 				foundComplexType = true
-				fmt.Printf("Found matching complex type for %s\n", baseTypeName)
+				debugf("Found matching complex type for %s\n", baseTypeName)
 				// Handle sequence elements
 				if t.Sequence != nil {
-					fmt.Printf("Processing sequence with %d elements\n", len(t.Sequence.Elements))
+					debugf("Processing sequence with %d elements\n", len(t.Sequence.Elements))
 					for _, e := range t.Sequence.Elements {
 						// Get the actual type, handling both direct types and references
 						fieldType := e.Type
@@ -473,29 +542,29 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 							goType = "[]" + goType
 						}
 
-						fmt.Printf("Adding sequence element %s of type %s (Go type: %s)\n", e.Name, fieldType, goType)
-						sb.WriteString("\t" + goFieldName(e.Name) + " " + goType + " `xml:\"" + e.Name + "\"`\n")
+						debugf("Adding sequence element %s of type %s (Go type: %s)\n", e.Name, fieldType, goType)
+						sb.WriteString("\t" + goFieldName(e.Name) + " " + goType + " " + elementTag(e) + "\n")
 					}
 				}
 
 				// Handle attributes
 				if len(t.Attributes) > 0 {
-					fmt.Printf("Processing %d attributes\n", len(t.Attributes))
+					debugf("Processing %d attributes\n", len(t.Attributes))
 					for _, attr := range t.Attributes {
 						fieldType := GoTypeName(attr.Type)
-						fmt.Printf("Adding attribute %s of type %s\n", attr.Name, fieldType)
+						debugf("Adding attribute %s of type %s\n", attr.Name, fieldType)
 						sb.WriteString("\t" + goFieldName(attr.Name) + " " + fieldType + " `xml:\"" + attr.Name + ",attr\"`\n")
 					}
 				}
 
 				// Handle simple content
 				if t.SimpleContent != nil {
-					fmt.Printf("Processing simple content with base type %s\n", t.SimpleContent.Extension.Base)
+					debugf("Processing simple content with base type %s\n", t.SimpleContent.Extension.Base)
 					baseType := GoTypeName(t.SimpleContent.Extension.Base)
 					sb.WriteString("\tValue " + baseType + " `xml:\",chardata\"`\n")
 					for _, attr := range t.SimpleContent.Extension.Attributes {
 						fieldType := GoTypeName(attr.Type)
-						fmt.Printf("Adding simple content attribute %s of type %s\n", attr.Name, fieldType)
+						debugf("Adding simple content attribute %s of type %s\n", attr.Name, fieldType)
 						sb.WriteString("\t" + goFieldName(attr.Name) + " " + fieldType + " `xml:\"" + attr.Name + ",attr\"`\n")
 					}
 				}
@@ -505,7 +574,7 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 		if !foundComplexType {
 			// If no complex type found, try to find a matching element with the same name
 			if matchingElem, ok := elementMap[baseTypeName]; ok {
-				fmt.Printf("Found matching element for %s\n", baseTypeName)
+				debugf("Found matching element for %s\n", baseTypeName)
 				if matchingElem.Type != "" {
 					// Process the element's type first if it's not a built-in type
 					if !isBuiltInType(matchingElem.Type) {
@@ -518,11 +587,11 @@ func buildStructsRecursive(typeMap map[string]xsComplexType, elementMap map[stri
 					if matchingElem.MaxOccurs != "" && matchingElem.MaxOccurs != "1" {
 						fieldType = "[]" + fieldType
 					}
-					fmt.Printf("Adding field %s of type %s\n", matchingElem.Name, fieldType)
-					sb.WriteString("\t" + goFieldName(matchingElem.Name) + " " + fieldType + " `xml:\"" + matchingElem.Name + "\"`\n")
+					debugf("Adding field %s of type %s\n", matchingElem.Name, fieldType)
+					sb.WriteString("\t" + goFieldName(matchingElem.Name) + " " + fieldType + " " + elementTag(matchingElem) + "\n")
 				}
 			} else {
-				fmt.Printf("Warning: No complex type or matching element found for %s\n", baseTypeName)
+				debugf("Warning: No complex type or matching element found for %s\n", baseTypeName)
 			}
 		}
 
@@ -579,6 +648,15 @@ func isBuiltInType(typeName string) bool {
 	return false
 }
 
+// elementTag returns the struct tag of an element field, optional elements
+// (minOccurs="0") are marked omitempty
+func elementTag(e xsElement) string {
+	if e.MinOccurs == "0" {
+		return "`xml:\"" + e.Name + ",omitempty\"`"
+	}
+	return "`xml:\"" + e.Name + "\"`"
+}
+
 func goFieldName(xmlName string) string {
 	if len(xmlName) == 0 {
 		return ""
@@ -588,12 +666,12 @@ func goFieldName(xmlName string) string {
 
 // processXSDImports processes XSD schema imports and merges them into the main WSDL
 func processXSDImports(wsdl *wsdlDefinitions, baseDir string) error {
-	fmt.Printf("Processing XSD imports in base directory: %s\n", baseDir)
+	debugf("Processing XSD imports in base directory: %s\n", baseDir)
 
 	// Process imports in each schema
 	for i := range wsdl.Types.Schemas {
 		schema := &wsdl.Types.Schemas[i]
-		fmt.Printf("Processing schema with target namespace: %s\n", schema.TargetNS)
+		debugf("Processing schema with target namespace: %s\n", schema.TargetNS)
 
 		// Process each import in the schema
 		for _, imp := range schema.Imports {
@@ -601,14 +679,14 @@ func processXSDImports(wsdl *wsdlDefinitions, baseDir string) error {
 				continue
 			}
 
-			fmt.Printf("Processing import: %s (namespace: %s)\n", imp.SchemaLocation, imp.Namespace)
+			debugf("Processing import: %s (namespace: %s)\n", imp.SchemaLocation, imp.Namespace)
 
 			// Resolve the import path relative to the base directory
 			importPath := filepath.Join(baseDir, imp.SchemaLocation)
-			
+
 			// Check if the imported file exists
 			if _, err := os.Stat(importPath); os.IsNotExist(err) {
-				fmt.Printf("Warning: imported XSD file not found: %s\n", importPath)
+				debugf("Warning: imported XSD file not found: %s\n", importPath)
 				continue
 			}
 
@@ -618,7 +696,7 @@ func processXSDImports(wsdl *wsdlDefinitions, baseDir string) error {
 				return fmt.Errorf("failed to read imported XSD file %s: %w", importPath, err)
 			}
 
-			fmt.Printf("Successfully read imported XSD file: %s (%d bytes)\n", importPath, len(importData))
+			debugf("Successfully read imported XSD file: %s (%d bytes)\n", importPath, len(importData))
 
 			// Parse the imported XSD
 			var importedSchema xsSchema
@@ -626,10 +704,10 @@ func processXSDImports(wsdl *wsdlDefinitions, baseDir string) error {
 				return fmt.Errorf("failed to parse imported XSD file %s: %w", importPath, err)
 			}
 
-			fmt.Printf("Successfully parsed imported XSD: %s\n", importPath)
-			fmt.Printf("  - Complex types: %d\n", len(importedSchema.ComplexTypes))
-			fmt.Printf("  - Simple types: %d\n", len(importedSchema.SimpleTypes))
-			fmt.Printf("  - Elements: %d\n", len(importedSchema.Elements))
+			debugf("Successfully parsed imported XSD: %s\n", importPath)
+			debugf("  - Complex types: %d\n", len(importedSchema.ComplexTypes))
+			debugf("  - Simple types: %d\n", len(importedSchema.SimpleTypes))
+			debugf("  - Elements: %d\n", len(importedSchema.Elements))
 
 			// Merge the imported schema into the main schema
 			schema.ComplexTypes = append(schema.ComplexTypes, importedSchema.ComplexTypes...)
@@ -660,6 +738,6 @@ func processXSDImports(wsdl *wsdlDefinitions, baseDir string) error {
 		}
 	}
 
-	fmt.Printf("Completed processing XSD imports\n")
+	debugf("Completed processing XSD imports\n")
 	return nil
 }
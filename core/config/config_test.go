@@ -0,0 +1,222 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	t.Setenv("TEST_COUNTRY_URL", "http://backend.internal/countryinfo")
+	t.Setenv("TEST_SOAP_USER", "proxy-user")
+
+	cfg, err := Load("testdata/config.yaml")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(cfg.Routes) != 2 {
+		t.Fatalf("loaded %d routes, want the route of the file and the included one", len(cfg.Routes))
+	}
+	flag, degrees := cfg.Routes[0], cfg.Routes[1]
+	if flag.SoapEndpoint != "http://backend.internal/countryinfo" {
+		t.Errorf("soap_endpoint = %q, want the environment variable", flag.SoapEndpoint)
+	}
+	if flag.Timeout != 15*time.Second {
+		t.Errorf("timeout = %v, want the default of the unset variable", flag.Timeout)
+	}
+	if flag.Security.Username != "proxy-user" || flag.Security.Password != "s3cr3t-password" {
+		t.Errorf("security = %q/%q, want the variable and the secret file without its newline", flag.Security.Username, flag.Security.Password)
+	}
+	if got := flag.Headers["X-Literal"]; got != "${NOT_A_REFERENCE}" {
+		t.Errorf("escaped reference = %q, want it kept literally", got)
+	}
+
+	// Schema defaults
+	if cfg.Server.Workers != 4 || cfg.Server.Port != 8080 || cfg.Server.QueueTimeout != 5*time.Second {
+		t.Errorf("server = %+v, want the configured workers and the default port and queue timeout", cfg.Server)
+	}
+	if degrees.Method != "POST" || degrees.Timeout != 30*time.Second || degrees.ResponseMode != "template" {
+		t.Errorf("included route = %s %v %s, want the default method, timeout and response mode", degrees.Method, degrees.Timeout, degrees.ResponseMode)
+	}
+	if flag.SoapVersion != "" {
+		t.Errorf("soap_version = %q, want it left to the WSDL binding", flag.SoapVersion)
+	}
+
+	for _, secret := range []string{"http://backend.internal/countryinfo", "proxy-user", "s3cr3t-password"} {
+		if !contains(cfg.Secrets(), secret) {
+			t.Errorf("Secrets() = %q, missing %q", cfg.Secrets(), secret)
+		}
+	}
+	for _, source := range []string{"testdata/config.yaml", filepath.Join("testdata", "routes", "degrees.yaml"), "testdata/password.txt"} {
+		if !contains(cfg.Sources(), source) {
+			t.Errorf("Sources() = %q, missing %q", cfg.Sources(), source)
+		}
+	}
+}
+
+func TestLoadUnresolved(t *testing.T) {
+	cfg, err := LoadUnresolved("testdata/config.yaml")
+	if err != nil {
+		t.Fatalf("LoadUnresolved() error = %v", err)
+	}
+	flag := cfg.Routes[0]
+	if flag.SoapEndpoint != "${TEST_COUNTRY_URL}" || flag.Security.Password != "${file:testdata/password.txt}" {
+		t.Errorf("route = %q, %q, want the references as written", flag.SoapEndpoint, flag.Security.Password)
+	}
+	if flag.Timeout != 15*time.Second {
+		t.Errorf("timeout = %v, want the default of the reference", flag.Timeout)
+	}
+	if len(cfg.Secrets()) != 0 {
+		t.Errorf("Secrets() = %q, want none", cfg.Secrets())
+	}
+}
+
+func TestLoadProblems(t *testing.T) {
+	const route = "  - path: /a\n    soap_endpoint: http://backend.internal/a\n    request_template: a.tmpl\n"
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		env   map[string]string
+		// want are the locations and message parts of the expected problems
+		want []Problem
+		// hidden must not appear in the error
+		hidden string
+	}{
+		{
+			name:  "missing variable",
+			files: map[string]string{"config.yaml": "routes:\n  - path: /a\n    soap_endpoint: ${TEST_MISSING_URL}\n    request_template: a.tmpl\n"},
+			want:  []Problem{{Path: "routes[0].soap_endpoint", Message: "environment variable TEST_MISSING_URL is not set"}},
+		},
+		{
+			name:  "invalid reference",
+			files: map[string]string{"config.yaml": "routes:\n  - path: /a\n    soap_endpoint: http://${1HOST}/a\n    request_template: a.tmpl\n"},
+			want:  []Problem{{Path: "routes[0].soap_endpoint", Message: "invalid reference ${1HOST}"}},
+		},
+		{
+			name:  "unterminated reference",
+			files: map[string]string{"config.yaml": "routes:\n  - path: /a\n    soap_endpoint: http://${HOST/a\n    request_template: a.tmpl\n"},
+			want:  []Problem{{Path: "routes[0].soap_endpoint", Message: "unterminated reference"}},
+		},
+		{
+			name:  "missing secret file",
+			files: map[string]string{"config.yaml": "routes:\n" + route + "    security:\n      username: u\n      password: ${file:/nonexistent/password}\n"},
+			want:  []Problem{{Path: "routes[0].security.password", Message: "failed to read secret file"}},
+		},
+		{
+			name:   "secret redacted from problems",
+			files:  map[string]string{"config.yaml": "routes:\n" + route + "    timeout: ${TEST_TIMEOUT}\n"},
+			env:    map[string]string{"TEST_TIMEOUT": "hunter2-secret"},
+			want:   []Problem{{Path: "routes[0].timeout", Message: strconv.Quote(Redacted) + " does not match the pattern"}},
+			hidden: "hunter2-secret",
+		},
+		{
+			name:  "missing required value",
+			files: map[string]string{"config.yaml": "routes:\n  - path: /a\n    soap_endpoint: http://backend.internal/a\n"},
+			want:  []Problem{{Path: "routes[0].request_template", Message: "is required"}},
+		},
+		{
+			name:  "enum",
+			files: map[string]string{"config.yaml": "routes:\n" + route + "    soap_version: \"1.3\"\n"},
+			want:  []Problem{{Path: "routes[0].soap_version", Message: "must be one of 1.1, 1.2"}},
+		},
+		{
+			name:  "duration pattern",
+			files: map[string]string{"config.yaml": "routes:\n" + route + "    timeout: soon\n"},
+			want:  []Problem{{Path: "routes[0].timeout", Message: "does not match the pattern"}},
+		},
+		{
+			name: "non-positive health check interval",
+			files: map[string]string{"config.yaml": "routes:\n" + route + "    load_balancing:\n      health_check:\n" +
+				"        request: probe.xml\n        interval: 0s\n"},
+			want: []Problem{{Path: "routes[0].load_balancing.health_check.interval", Message: "is not a positive duration"}},
+		},
+		{
+			name: "problem in an included file",
+			files: map[string]string{
+				"config.yaml":      "include: [routes/*.yaml]\nroutes:\n" + route,
+				"routes/more.yaml": "routes:\n  - path: /b\n    soap_endpoint: http://backend.internal/b\n    request_template: b.tmpl\n    timeout: soon\n",
+			},
+			want: []Problem{{File: "routes/more.yaml", Path: "routes[0].timeout", Message: "does not match the pattern"}},
+		},
+		{
+			name: "include in an included file",
+			files: map[string]string{
+				"config.yaml":      "include: [routes/*.yaml]\nroutes:\n" + route,
+				"routes/more.yaml": "include: [../config.yaml]\nroutes: []\n",
+			},
+			want: []Problem{{File: "routes/more.yaml", Path: "include", Message: "only routes are"}},
+		},
+		{
+			name:  "missing included file",
+			files: map[string]string{"config.yaml": "include: [routes/more.yaml]\nroutes:\n" + route},
+			want:  []Problem{{Path: "include[0]", Message: "does not exist"}},
+		},
+		{
+			name: "duplicate route across files",
+			files: map[string]string{
+				"config.yaml":      "include: [routes/*.yaml]\nroutes:\n" + route,
+				"routes/more.yaml": "routes:\n" + route,
+			},
+			want: []Problem{{File: "routes/more.yaml", Path: "routes[0]", Message: "duplicates route POST /a of routes[0]"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := Load(filepath.Join(dir, "config.yaml"))
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("Load() error = %v, want a *ValidationError", err)
+			}
+			if tt.hidden != "" && strings.Contains(err.Error(), tt.hidden) {
+				t.Errorf("error %q shows the secret %q", err, tt.hidden)
+			}
+			for _, want := range tt.want {
+				if want.File != "" {
+					want.File = filepath.Join(dir, want.File)
+				}
+				if !hasProblem(invalid.Problems, want) {
+					t.Errorf("problems = %v, want one at %s containing %q", invalid.Problems, want.location(), want.Message)
+				}
+			}
+		})
+	}
+}
+
+func hasProblem(problems []Problem, want Problem) bool {
+	for _, p := range problems {
+		if p.File == want.File && p.Path == want.Path && strings.Contains(p.Message, want.Message) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
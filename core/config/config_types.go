@@ -2,7 +2,11 @@ package config
 
 import (
 	"encoding/json"
-	"os"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -11,6 +15,13 @@ type Config struct {
 	Server  ServerConfig  `json:"server"`
 	Routes  []RouteConfig `json:"routes"`
 	Logging LogConfig     `json:"logging"`
+
+	// secrets are the values resolved from environment variables and secret files
+	secrets []string
+	// sources are the files and directories the configuration was read from
+	sources []string
+	// origins are the files the routes were read from
+	origins []routeOrigin
 }
 
 // ServerConfig holds server-specific configuration
@@ -19,6 +30,11 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `json:"read_timeout"`
 	WriteTimeout time.Duration `json:"write_timeout"`
 	IdleTimeout  time.Duration `json:"idle_timeout"`
+	Workers      int           `json:"workers"`
+	QueueSize    int           `json:"queue_size"`
+	QueueTimeout time.Duration `json:"queue_timeout"`
+	// CacheMaxEntries bounds the in-memory response cache shared by the routes
+	CacheMaxEntries int `json:"cache_max_entries"`
 }
 
 // LogConfig defines logging configuration
@@ -38,23 +54,361 @@ type RouteConfig struct {
 	Headers          map[string]string `json:"headers"`
 	WSDLURL          string            `json:"wsdl_url,omitempty"`
 	Timeout          time.Duration     `json:"timeout"`
+	Transport        TransportConfig   `json:"transport"`
+	ResponseMode     string            `json:"response_mode,omitempty"`
+	FieldNaming      string            `json:"field_naming,omitempty"`
+	ValidateRequest  bool              `json:"validate_request,omitempty"`
+	ValidateParams   map[string]string `json:"validate_params,omitempty"`
+	Faults           []FaultMapping    `json:"faults,omitempty"`
+	SoapVersion      string            `json:"soap_version,omitempty"`
+	SoapActionURI    string            `json:"soap_action_uri,omitempty"`
+	BindingStyle     string            `json:"binding_style,omitempty"`
+	Mode             string            `json:"mode,omitempty"`
+	Security         *SecurityConfig   `json:"security,omitempty"`
+	Idempotent       bool              `json:"idempotent,omitempty"`
+	Retry            *RetryConfig      `json:"retry,omitempty"`
+	CircuitBreaker   *BreakerConfig    `json:"circuit_breaker,omitempty"`
+	SoapEndpoints    []EndpointConfig  `json:"soap_endpoints,omitempty"`
+	LoadBalancing    *BalancingConfig  `json:"load_balancing,omitempty"`
+	Cache            *CacheConfig      `json:"cache,omitempty"`
+	Coalesce         bool              `json:"coalesce,omitempty"`
+}
+
+// CacheConfig configures the response cache of a read-only route
+type CacheConfig struct {
+	// TTL is how long a SOAP response is served without calling the backend
+	TTL time.Duration `json:"ttl"`
+	// StaleWhileRevalidate is how long an expired response is still served
+	// while it is refreshed in the background
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate,omitempty"`
+	// Key lists the request values the cache key is built from, such as
+	// path.iso or query.lang. The rendered SOAP request is the key when empty.
+	Key []string `json:"key,omitempty"`
+}
+
+// EndpointConfig is one node of a SOAP service reached by several endpoints
+type EndpointConfig struct {
+	URL string `json:"url"`
+	// Weight is the share of requests of the weighted strategy
+	Weight int `json:"weight"`
+}
+
+// Load balancing strategies across the endpoints of a route
+const (
+	BalanceRoundRobin       = "round_robin"
+	BalanceWeighted         = "weighted"
+	BalanceLeastOutstanding = "least_outstanding"
+)
+
+// BalancingConfig configures how requests are spread across the endpoints of a route
+type BalancingConfig struct {
+	// Strategy is round_robin, weighted or least_outstanding
+	Strategy string `json:"strategy"`
+	// EjectAfter consecutive failed calls take an endpoint out of rotation for EjectDuration
+	EjectAfter    int           `json:"eject_after"`
+	EjectDuration time.Duration `json:"eject_duration"`
+	// HealthCheck probes the endpoints in the background when set
+	HealthCheck *HealthCheckConfig `json:"health_check,omitempty"`
+}
+
+// HealthCheckConfig configures the active health checks of the endpoints of a route
+type HealthCheckConfig struct {
+	// SoapAction is the SOAP action of the probe operation, sent as is
+	SoapAction string `json:"soap_action"`
+	// Request is the file holding the SOAP envelope sent as probe
+	Request  string        `json:"request"`
+	Interval time.Duration `json:"interval"`
+	Timeout  time.Duration `json:"timeout"`
+}
+
+// BreakerConfig configures the circuit breaker of the SOAP endpoint of a route
+type BreakerConfig struct {
+	// FailureRate opens the breaker when reached by the failed calls of the window
+	FailureRate float64 `json:"failure_rate"`
+	// SlowCallRate opens the breaker when reached by the calls slower than
+	// SlowCallDuration, slow calls are not tracked without a duration
+	SlowCallRate     float64       `json:"slow_call_rate"`
+	SlowCallDuration time.Duration `json:"slow_call_duration,omitempty"`
+	// WindowSize is the number of latest calls the rates are computed on
+	WindowSize int `json:"window_size"`
+	// MinimumCalls is the number of calls needed before the rates are evaluated
+	MinimumCalls int `json:"minimum_calls"`
+	// OpenDuration is how long calls are rejected before the endpoint is probed
+	OpenDuration time.Duration `json:"open_duration"`
+	// HalfOpenCalls is the number of probe calls that must succeed to close the breaker
+	HalfOpenCalls int `json:"half_open_calls"`
+}
+
+// RetryConfig configures how failed upstream calls of an idempotent route are retried
+type RetryConfig struct {
+	// MaxAttempts bounds the upstream calls of one request, the first call included
+	MaxAttempts int `json:"max_attempts"`
+	// Backoff is the delay before the first retry, doubled for every further
+	// retry up to MaxBackoff
+	Backoff    time.Duration `json:"backoff"`
+	MaxBackoff time.Duration `json:"max_backoff"`
+	// Jitter shortens every delay by a random fraction of up to Jitter
+	Jitter float64 `json:"jitter"`
+	// ConnectionErrors retries calls whose connection was refused, reset or closed
+	ConnectionErrors bool `json:"connection_errors"`
+	// Statuses lists the upstream HTTP statuses that are retried
+	Statuses []int `json:"statuses,omitempty"`
+	// FaultCodes lists the SOAP fault codes that are retried
+	FaultCodes []string `json:"fault_codes,omitempty"`
+}
+
+// SecurityConfig configures the WS-Security header added to the requests of a route
+type SecurityConfig struct {
+	// Username and Password add a UsernameToken when Username is set
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// PasswordType is PasswordText or PasswordDigest
+	PasswordType string `json:"password_type,omitempty"`
+	// TimestampTTL adds a wsu:Timestamp expiring after the duration when set
+	TimestampTTL   time.Duration `json:"timestamp_ttl,omitempty"`
+	MustUnderstand bool          `json:"must_understand,omitempty"`
+	// SignCert and SignKey are the PEM certificate and RSA key signing the
+	// Body and Timestamp of requests
+	SignCert string `json:"sign_cert,omitempty"`
+	SignKey  string `json:"sign_key,omitempty"`
+	// VerifyCert is the PEM certificate responses must be signed with
+	VerifyCert string `json:"verify_cert,omitempty"`
+}
+
+// FaultMapping maps the SOAP faults of a route to an HTTP status. All criteria
+// that are set must match, the first matching mapping wins.
+type FaultMapping struct {
+	// Code matches the local part of the faultcode, e.g. `Client` also matches `soap:Client.Auth`
+	Code string `json:"code,omitempty"`
+	// Match is a regular expression matched against the faultstring
+	Match string `json:"match,omitempty"`
+	// Detail matches the local name of the first element of the fault detail
+	Detail string `json:"detail,omitempty"`
+	Status int    `json:"status"`
+	// Type and Title override the problem type URI and title of the response
+	Type  string `json:"type,omitempty"`
+	Title string `json:"title,omitempty"`
 }
 
-// Load loads the configuration from a file
+// Response modes of a route
+const (
+	// ResponseModeTemplate renders the SOAP response with the response template
+	ResponseModeTemplate = "template"
+	// ResponseModeAuto marshals the typed SOAP response straight to JSON
+	ResponseModeAuto = "auto"
+)
+
+// Modes of a route
+const (
+	// ModeGenerated uses the parser generated by cmd/build
+	ModeGenerated = "generated"
+	// ModeDynamic loads the WSDL at startup and parses responses into a generic tree
+	ModeDynamic = "dynamic"
+)
+
+// SOAP versions of a route
+const (
+	SoapVersion11 = "1.1"
+	SoapVersion12 = "1.2"
+)
+
+// Password types of a WS-Security UsernameToken
+const (
+	PasswordText   = "PasswordText"
+	PasswordDigest = "PasswordDigest"
+)
+
+// Field naming strategies for auto response mode
+const (
+	FieldNamingCamelCase = "camelCase"
+	FieldNamingOriginal  = "original"
+	FieldNamingSnakeCase = "snake_case"
+)
+
+// TransportConfig holds the HTTP transport settings used to reach a SOAP backend
+type TransportConfig struct {
+	MaxIdleConns          int           `json:"max_idle_conns"`
+	MaxIdleConnsPerHost   int           `json:"max_idle_conns_per_host"`
+	IdleConnTimeout       time.Duration `json:"idle_conn_timeout"`
+	TLSHandshakeTimeout   time.Duration `json:"tls_handshake_timeout"`
+	KeepAlive             time.Duration `json:"keep_alive"`
+	ResponseHeaderTimeout time.Duration `json:"response_header_timeout"`
+	TLS                   *TLSConfig    `json:"tls,omitempty"`
+}
+
+// TLSConfig holds the TLS settings used to reach an HTTPS backend. The
+// certificate files are re-read when they change on disk.
+type TLSConfig struct {
+	// CAFile is a PEM bundle of the CAs trusted for the backend instead of the system roots
+	CAFile string `json:"ca_file,omitempty"`
+	// CertFile and KeyFile hold the client certificate presented to the backend
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// ServerName overrides the name sent in SNI and checked against the backend certificate
+	ServerName string `json:"server_name,omitempty"`
+	// MinVersion is the lowest TLS version accepted, one of 1.0, 1.1, 1.2 and 1.3
+	MinVersion string `json:"min_version,omitempty"`
+	// CipherSuites restricts the TLS 1.0-1.2 cipher suites by their IANA names
+	CipherSuites []string `json:"cipher_suites,omitempty"`
+}
+
+// HTTPMethod returns the upper-cased HTTP method of the route, POST if unset
+func (r RouteConfig) HTTPMethod() string {
+	if r.Method == "" {
+		return http.MethodPost
+	}
+	return strings.ToUpper(r.Method)
+}
+
+// EnvelopeVersion returns the SOAP version of the route, 1.1 if unset
+func (r RouteConfig) EnvelopeVersion() string {
+	if r.SoapVersion == "" {
+		return SoapVersion11
+	}
+	return r.SoapVersion
+}
+
+// Endpoints returns the endpoints of the route, soap_endpoint being a single
+// endpoint of weight 1
+func (r RouteConfig) Endpoints() []EndpointConfig {
+	if len(r.SoapEndpoints) > 0 {
+		return r.SoapEndpoints
+	}
+	if r.SoapEndpoint == "" {
+		return nil
+	}
+	return []EndpointConfig{{URL: r.SoapEndpoint, Weight: 1}}
+}
+
+// ParamRef is a request parameter checked against the request schema
+type ParamRef struct {
+	// Key is the validate_params key, such as path.iso
+	Key string
+	// Source is "path" or "query"
+	Source string
+	Name   string
+	// Element is the dotted path of the schema element checking the values
+	Element string
+}
+
+// ParamRefs returns the validate_params of the route sorted by key. Keys are
+// query.<name> or path.<name>, with a parameter declared in the route path.
+func (r RouteConfig) ParamRefs() ([]ParamRef, error) {
+	refs := make([]ParamRef, 0, len(r.ValidateParams))
+	for key, element := range r.ValidateParams {
+		source, name, _ := strings.Cut(key, ".")
+		switch {
+		case name == "" || (source != "path" && source != "query"):
+			return nil, fmt.Errorf("validate_params key %q must be path.<name> or query.<name>", key)
+		case source == "path" && !strings.Contains(r.Path, "{"+name+"}"):
+			return nil, fmt.Errorf("validate_params key %q is not a parameter of %s", key, r.Path)
+		}
+		refs = append(refs, ParamRef{Key: key, Source: source, Name: name, Element: element})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Key < refs[j].Key })
+	return refs, nil
+}
+
+// WithDefaults returns the route with its endpoint, SOAP version, soapAction
+// and binding style taken from d where they are not configured. The WSDL
+// address is not used by routes with soap_endpoints.
+func (r RouteConfig) WithDefaults(d RouteConfig) RouteConfig {
+	if r.SoapEndpoint == "" && len(r.SoapEndpoints) == 0 {
+		r.SoapEndpoint = d.SoapEndpoint
+	}
+	if r.SoapVersion == "" {
+		r.SoapVersion = d.SoapVersion
+	}
+	if r.SoapActionURI == "" {
+		r.SoapActionURI = d.SoapActionURI
+	}
+	if r.BindingStyle == "" {
+		r.BindingStyle = d.BindingStyle
+	}
+	return r
+}
+
+// Key returns the identifier of the route in the route registry
+func (r RouteConfig) Key() string {
+	return r.HTTPMethod() + " " + r.Path
+}
+
+// Load loads the configuration from a JSON or YAML file, selected by its
+// extension, merged with the route files matched by its `include` patterns.
+// References to environment variables and secret files in string values are
+// resolved first, then the configuration is validated against
+// config.schema.json and missing values are filled from the schema defaults.
+// Every problem, duplicate routes included, is reported in a *ValidationError.
 func Load(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	return load(path, newInterpolator())
+}
+
+// LoadUnresolved loads the configuration like Load but keeps the references
+// to environment variables and secret files as written, without reading
+// them, or uses their default. Values keeping a reference are not checked
+// against the schema.
+// It is meant for cmd/build, which must neither need nor see the secrets.
+func LoadUnresolved(path string) (*Config, error) {
+	in := newInterpolator()
+	in.keep = true
+	in.references = make(map[string]bool)
+	return load(path, in)
+}
+
+func load(path string, in *interpolator) (*Config, error) {
+	doc, problems, err := readDocument(path)
 	if err != nil {
 		return nil, err
 	}
 
+	in.walk(doc.root, "")
+	secrets := in.secretList()
+
+	for _, problem := range append(in.problems, applySchema(doc.root)...) {
+		if in.references[problem.Path] {
+			continue
+		}
+		problems = append(problems, doc.locate(problem))
+	}
+
 	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, err
+	if len(problems) == 0 {
+		data, err := json.Marshal(doc.root)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, errors.New(Redact(err.Error(), secrets))
+		}
+		problems = doc.duplicateRoutes(config.Routes)
 	}
 
+	if len(problems) > 0 {
+		for i := range problems {
+			problems[i].Message = Redact(problems[i].Message, secrets)
+		}
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	config.secrets = secrets
+	config.sources = append(doc.sources, in.files...)
+	config.origins = doc.origins
+
 	return &config, nil
 }
 
+// Secrets returns the values resolved from environment variables and secret
+// files, which must not appear in logs
+func (c *Config) Secrets() []string {
+	return c.secrets
+}
+
+// Sources returns the configuration file, the included route files and
+// directories and the secret files the configuration was read from
+func (c *Config) Sources() []string {
+	return c.sources
+}
+
 // UnmarshalJSON implements custom JSON unmarshaling for time.Duration fields
 func (s *ServerConfig) UnmarshalJSON(data []byte) error {
 	type Alias ServerConfig
@@ -62,6 +416,7 @@ func (s *ServerConfig) UnmarshalJSON(data []byte) error {
 		ReadTimeout  string `json:"read_timeout"`
 		WriteTimeout string `json:"write_timeout"`
 		IdleTimeout  string `json:"idle_timeout"`
+		QueueTimeout string `json:"queue_timeout"`
 		*Alias
 	}{
 		Alias: (*Alias)(s),
@@ -87,6 +442,14 @@ func (s *ServerConfig) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
+	// The queue timeout is optional, the pool falls back to its default
+	if aux.QueueTimeout != "" {
+		s.QueueTimeout, err = time.ParseDuration(aux.QueueTimeout)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -112,3 +475,245 @@ func (r *RouteConfig) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// UnmarshalJSON implements custom JSON unmarshaling for SecurityConfig
+func (s *SecurityConfig) UnmarshalJSON(data []byte) error {
+	type Alias SecurityConfig
+	aux := &struct {
+		TimestampTTL string `json:"timestamp_ttl"`
+		*Alias
+	}{
+		Alias: (*Alias)(s),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	// The timestamp is optional, no TTL means no wsu:Timestamp
+	if aux.TimestampTTL != "" {
+		var err error
+		s.TimestampTTL, err = time.ParseDuration(aux.TimestampTTL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for RetryConfig
+func (r *RetryConfig) UnmarshalJSON(data []byte) error {
+	type Alias RetryConfig
+	aux := &struct {
+		Backoff    string `json:"backoff"`
+		MaxBackoff string `json:"max_backoff"`
+		*Alias
+	}{
+		Alias: (*Alias)(r),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	durations := []struct {
+		value string
+		dest  *time.Duration
+	}{
+		{aux.Backoff, &r.Backoff},
+		{aux.MaxBackoff, &r.MaxBackoff},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return err
+		}
+		*d.dest = parsed
+	}
+
+	return nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for BreakerConfig
+func (b *BreakerConfig) UnmarshalJSON(data []byte) error {
+	type Alias BreakerConfig
+	aux := &struct {
+		SlowCallDuration string `json:"slow_call_duration"`
+		OpenDuration     string `json:"open_duration"`
+		*Alias
+	}{
+		Alias: (*Alias)(b),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	durations := []struct {
+		value string
+		dest  *time.Duration
+	}{
+		{aux.SlowCallDuration, &b.SlowCallDuration},
+		{aux.OpenDuration, &b.OpenDuration},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return err
+		}
+		*d.dest = parsed
+	}
+
+	return nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for BalancingConfig
+func (b *BalancingConfig) UnmarshalJSON(data []byte) error {
+	type Alias BalancingConfig
+	aux := &struct {
+		EjectDuration string `json:"eject_duration"`
+		*Alias
+	}{
+		Alias: (*Alias)(b),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if aux.EjectDuration != "" {
+		var err error
+		b.EjectDuration, err = time.ParseDuration(aux.EjectDuration)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for HealthCheckConfig
+func (h *HealthCheckConfig) UnmarshalJSON(data []byte) error {
+	type Alias HealthCheckConfig
+	aux := &struct {
+		Interval string `json:"interval"`
+		Timeout  string `json:"timeout"`
+		*Alias
+	}{
+		Alias: (*Alias)(h),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	durations := []struct {
+		value string
+		dest  *time.Duration
+	}{
+		{aux.Interval, &h.Interval},
+		{aux.Timeout, &h.Timeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return err
+		}
+		*d.dest = parsed
+	}
+
+	return nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for CacheConfig
+func (c *CacheConfig) UnmarshalJSON(data []byte) error {
+	type Alias CacheConfig
+	aux := &struct {
+		TTL                  string `json:"ttl"`
+		StaleWhileRevalidate string `json:"stale_while_revalidate"`
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	durations := []struct {
+		value string
+		dest  *time.Duration
+	}{
+		{aux.TTL, &c.TTL},
+		{aux.StaleWhileRevalidate, &c.StaleWhileRevalidate},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return err
+		}
+		*d.dest = parsed
+	}
+
+	return nil
+}
+
+// UnmarshalJSON implements custom JSON unmarshaling for TransportConfig.
+// All durations are optional, unset values keep the transport defaults.
+func (t *TransportConfig) UnmarshalJSON(data []byte) error {
+	type Alias TransportConfig
+	aux := &struct {
+		IdleConnTimeout       string `json:"idle_conn_timeout"`
+		TLSHandshakeTimeout   string `json:"tls_handshake_timeout"`
+		KeepAlive             string `json:"keep_alive"`
+		ResponseHeaderTimeout string `json:"response_header_timeout"`
+		*Alias
+	}{
+		Alias: (*Alias)(t),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	durations := []struct {
+		value string
+		dest  *time.Duration
+	}{
+		{aux.IdleConnTimeout, &t.IdleConnTimeout},
+		{aux.TLSHandshakeTimeout, &t.TLSHandshakeTimeout},
+		{aux.KeepAlive, &t.KeepAlive},
+		{aux.ResponseHeaderTimeout, &t.ResponseHeaderTimeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return err
+		}
+		*d.dest = parsed
+	}
+
+	return nil
+}
+
+// Locate attributes a problem found in Routes to the included file the route
+// was read from
+func (c *Config) Locate(p Problem) Problem {
+	return locateProblem(c.origins, p)
+}
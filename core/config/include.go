@@ -0,0 +1,201 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// document is a configuration file merged with the route files it includes
+type document struct {
+	root map[string]interface{}
+
+	// origins records the file and index each merged route was read from
+	origins []routeOrigin
+	// sources are the files and include directories the document was read from
+	sources []string
+}
+
+// routeOrigin is the file a route was read from, empty for the
+// configuration file itself, and its index in that file
+type routeOrigin struct {
+	file  string
+	index int
+}
+
+// readDocument reads a configuration file and merges the routes of the files
+// matched by its `include` patterns. Patterns are relative to the directory
+// of the configuration file and included files may only declare routes.
+func readDocument(path string) (*document, []Problem, error) {
+	root, err := decodeFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc := &document{root: root, sources: []string{path}}
+	if routes, ok := root["routes"].([]interface{}); ok {
+		for i := range routes {
+			doc.origins = append(doc.origins, routeOrigin{index: i})
+		}
+	}
+
+	patterns, ok := root["include"].([]interface{})
+	if !ok {
+		return doc, nil, nil
+	}
+
+	var problems []Problem
+	dir := filepath.Dir(path)
+	for i, p := range patterns {
+		at := fmt.Sprintf("include[%d]", i)
+		pattern, ok := p.(string)
+		if !ok {
+			// Reported by the schema
+			continue
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			problems = append(problems, Problem{Path: at, Message: fmt.Sprintf("invalid pattern %q: %v", p, err)})
+			continue
+		}
+		// New files in an include directory are picked up on reload
+		doc.sources = append(doc.sources, filepath.Dir(pattern))
+		if len(files) == 0 && !hasMeta(pattern) {
+			problems = append(problems, Problem{Path: at, Message: fmt.Sprintf("included file %s does not exist", pattern)})
+			continue
+		}
+
+		sort.Strings(files)
+		for _, file := range files {
+			included, err := decodeFile(file)
+			if err != nil {
+				problems = append(problems, Problem{File: file, Message: err.Error()})
+				continue
+			}
+			names := make([]string, 0, len(included))
+			for name := range included {
+				if name != "routes" {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				problems = append(problems, Problem{File: file, Path: name, Message: "is not allowed in an included file, only routes are"})
+			}
+			doc.sources = append(doc.sources, file)
+			doc.addRoutes(file, included["routes"])
+		}
+	}
+
+	return doc, problems, nil
+}
+
+// addRoutes appends the routes of an included file to the merged document
+func (d *document) addRoutes(file string, value interface{}) {
+	routes, ok := value.([]interface{})
+	if !ok {
+		// A missing or malformed list is reported by the schema
+		return
+	}
+
+	merged, ok := d.root["routes"].([]interface{})
+	if !ok && d.root["routes"] != nil {
+		return
+	}
+	for i, route := range routes {
+		merged = append(merged, route)
+		d.origins = append(d.origins, routeOrigin{file: file, index: i})
+	}
+	d.root["routes"] = merged
+}
+
+// locate attributes a problem of the merged document to the file it comes from
+func (d *document) locate(p Problem) Problem {
+	return locateProblem(d.origins, p)
+}
+
+func locateProblem(origins []routeOrigin, p Problem) Problem {
+	if p.File != "" || !strings.HasPrefix(p.Path, "routes[") {
+		return p
+	}
+
+	var index int
+	if _, err := fmt.Sscanf(p.Path, "routes[%d]", &index); err != nil || index >= len(origins) {
+		return p
+	}
+	origin := origins[index]
+	if origin.file == "" {
+		return p
+	}
+
+	rest := strings.TrimPrefix(p.Path, fmt.Sprintf("routes[%d]", index))
+	p.File = origin.file
+	p.Path = fmt.Sprintf("routes[%d]%s", origin.index, rest)
+	return p
+}
+
+// duplicateRoutes reports routes declared more than once for the same
+// method and path
+func (d *document) duplicateRoutes(routes []RouteConfig) []Problem {
+	var problems []Problem
+	seen := make(map[string]int, len(routes))
+	for i, route := range routes {
+		first, ok := seen[route.Key()]
+		if !ok {
+			seen[route.Key()] = i
+			continue
+		}
+		problem := d.locate(Problem{Path: fmt.Sprintf("routes[%d]", i)})
+		previous := d.locate(Problem{Path: fmt.Sprintf("routes[%d]", first)})
+		problem.Message = fmt.Sprintf("duplicates route %s of %s", route.Key(), previous.location())
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// decodeFile reads a JSON or YAML file, selected by its extension, into
+// generic values with JSON numbers
+func decodeFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var value interface{}
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		// Re-encode as JSON so both formats decode to the same values
+		data, err = json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported YAML value: %w", err)
+		}
+	}
+
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	return doc, nil
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
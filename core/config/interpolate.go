@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envName is the syntax of an environment variable reference
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// minSecretLength is the length under which resolved values are not
+// redacted, shorter values would mask unrelated text in the logs
+const minSecretLength = 4
+
+// interpolator resolves `${ENV_VAR}`, `${ENV_VAR:-default}` and
+// `${file:/path}` references in the string values of a configuration and
+// records the resolved values as secrets
+type interpolator struct {
+	problems []Problem
+	secrets  map[string]bool
+	// files are the secret files that were read
+	files []string
+	// keep leaves the references as written instead of resolving them, or
+	// uses their default, recording the paths of the values that keep one
+	keep       bool
+	references map[string]bool
+}
+
+func newInterpolator() *interpolator {
+	return &interpolator{secrets: make(map[string]bool)}
+}
+
+// walk replaces the references in every string of a decoded JSON document
+func (in *interpolator) walk(value interface{}, path string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			v[name] = in.walk(v[name], joinPath(path, name))
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = in.walk(child, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case string:
+		return in.expand(v, path)
+	}
+	return value
+}
+
+// expand resolves the references of one string value, `$${` is kept as a
+// literal `${`
+func (in *interpolator) expand(s, path string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+
+	var sb strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			sb.WriteString(s)
+			return sb.String()
+		}
+		if start > 0 && s[start-1] == '$' {
+			sb.WriteString(s[:start])
+			sb.WriteString("{")
+			s = s[start+2:]
+			continue
+		}
+
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			in.report(path, "unterminated reference %q", s[start:])
+			sb.WriteString(s)
+			return sb.String()
+		}
+		end += start
+
+		sb.WriteString(s[:start])
+		sb.WriteString(in.resolve(s[start+2:end], path))
+		s = s[end+1:]
+	}
+}
+
+// resolve returns the value of a single reference
+func (in *interpolator) resolve(ref, path string) string {
+	if in.keep {
+		if _, fallback, hasDefault := strings.Cut(ref, ":-"); hasDefault && !strings.HasPrefix(ref, "file:") {
+			return fallback
+		}
+		in.references[path] = true
+		return "${" + ref + "}"
+	}
+	if file, ok := strings.CutPrefix(ref, "file:"); ok {
+		in.files = append(in.files, file)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			in.report(path, "failed to read secret file: %v", err)
+			return ""
+		}
+		value := strings.TrimRight(string(data), "\r\n")
+		in.addSecret(value)
+		return value
+	}
+
+	name, fallback, hasDefault := strings.Cut(ref, ":-")
+	if !envName.MatchString(name) {
+		in.report(path, "invalid reference ${%s}", ref)
+		return ""
+	}
+	value, ok := os.LookupEnv(name)
+	if ok && (value != "" || !hasDefault) {
+		in.addSecret(value)
+		return value
+	}
+	if hasDefault {
+		return fallback
+	}
+	in.report(path, "environment variable %s is not set", name)
+	return ""
+}
+
+func (in *interpolator) addSecret(value string) {
+	if len(value) >= minSecretLength {
+		in.secrets[value] = true
+	}
+}
+
+func (in *interpolator) report(path, format string, args ...interface{}) {
+	in.problems = append(in.problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// secretList returns the resolved values, longest first so a secret that
+// contains another one is redacted as a whole
+func (in *interpolator) secretList() []string {
+	secrets := make([]string, 0, len(in.secrets))
+	for secret := range in.secrets {
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		if len(secrets[i]) != len(secrets[j]) {
+			return len(secrets[i]) > len(secrets[j])
+		}
+		return secrets[i] < secrets[j]
+	})
+	return secrets
+}
+
+// Redacted is the text that replaces secrets in logs and error messages
+const Redacted = "[REDACTED]"
+
+// Redact replaces every occurrence of the secrets in s
+func Redact(s string, secrets []string) string {
+	if len(secrets) == 0 {
+		return s
+	}
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, Redacted)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
@@ -0,0 +1,323 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed config.schema.json
+var schemaJSON []byte
+
+// Problem is a configuration value that does not match the schema
+type Problem struct {
+	// File is the included file the value was read from, empty for the
+	// configuration file itself
+	File string
+	// Path is the JSON path of the value, e.g. `routes[1].timeout`
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	if location := p.location(); location != "" {
+		return location + ": " + p.Message
+	}
+	return p.Message
+}
+
+// location returns the file and path of the problem
+func (p Problem) location() string {
+	switch {
+	case p.File == "":
+		return p.Path
+	case p.Path == "":
+		return p.File
+	}
+	return p.File + ": " + p.Path
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		lines = append(lines, p.String())
+	}
+	return "invalid configuration:\n  " + strings.Join(lines, "\n  ")
+}
+
+// jsonSchema is the subset of JSON Schema used by config.schema.json
+type jsonSchema struct {
+	Type                 string                 `json:"type"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	Enum                 []interface{}          `json:"enum"`
+	Pattern              string                 `json:"pattern"`
+	Format               string                 `json:"format"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	Default              json.RawMessage        `json:"default"`
+
+	pattern *regexp.Regexp
+}
+
+var configSchema = mustParseSchema(schemaJSON)
+
+func mustParseSchema(data []byte) *jsonSchema {
+	var s jsonSchema
+	if err := json.Unmarshal(data, &s); err != nil {
+		panic(fmt.Sprintf("invalid config schema: %v", err))
+	}
+	s.compile()
+	return &s
+}
+
+func (s *jsonSchema) compile() {
+	if s.Pattern != "" {
+		s.pattern = regexp.MustCompile(s.Pattern)
+	}
+	for _, p := range s.Properties {
+		p.compile()
+	}
+	for _, sub := range append([]*jsonSchema{s.AdditionalProperties, s.Items}, s.AnyOf...) {
+		if sub != nil {
+			sub.compile()
+		}
+	}
+}
+
+// applySchema validates a decoded JSON document against the configuration
+// schema and fills in the defaults of missing properties
+func applySchema(doc interface{}) []Problem {
+	var problems []Problem
+	configSchema.apply(doc, "", &problems)
+	return problems
+}
+
+func (s *jsonSchema) apply(value interface{}, path string, problems *[]Problem) {
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !hasType(value, s.Type) {
+		report("must be %s %s, got %s", article(s.Type), s.Type, typeName(value))
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		s.applyObject(v, path, problems)
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.apply(item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case string:
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			report("%q does not match the pattern %s", v, s.Pattern)
+		}
+		if msg := checkFormat(s.Format, v); msg != "" {
+			report("%q %s", v, msg)
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			report("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			report("must be at most %v", *s.Maximum)
+		}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		report("must be one of %s", enumList(s.Enum))
+	}
+}
+
+func (s *jsonSchema) applyObject(obj map[string]interface{}, path string, problems *[]Problem) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			*problems = append(*problems, Problem{Path: joinPath(path, name), Message: "is required"})
+		}
+	}
+
+	if len(s.AnyOf) > 0 && !s.matchesAnyOf(obj) {
+		var alternatives []string
+		for _, alt := range s.AnyOf {
+			alternatives = append(alternatives, strings.Join(alt.Required, " and "))
+		}
+		*problems = append(*problems, Problem{Path: path, Message: "requires one of " + strings.Join(alternatives, ", ")})
+	}
+
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop := s.Properties[name]
+		value, ok := obj[name]
+		if !ok {
+			if len(prop.Default) == 0 {
+				continue
+			}
+			value = decodeDefault(prop.Default)
+			obj[name] = value
+		}
+		prop.apply(value, joinPath(path, name), problems)
+	}
+
+	if s.AdditionalProperties == nil {
+		return
+	}
+	extra := make([]string, 0, len(obj))
+	for name := range obj {
+		if _, known := s.Properties[name]; !known {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		s.AdditionalProperties.apply(obj[name], joinPath(path, name), problems)
+	}
+}
+
+// matchesAnyOf reports whether the object satisfies the required properties of one alternative
+func (s *jsonSchema) matchesAnyOf(obj map[string]interface{}) bool {
+	for _, alt := range s.AnyOf {
+		ok := true
+		for _, name := range alt.Required {
+			if _, present := obj[name]; !present {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeDefault decodes a default value so every use gets its own copy
+func decodeDefault(raw json.RawMessage) interface{} {
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	decoder.Decode(&value)
+	return value
+}
+
+func hasType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	}
+	return true
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func article(word string) string {
+	if strings.ContainsRune("aeiou", rune(word[0])) {
+		return "an"
+	}
+	return "a"
+}
+
+// checkFormat validates the formats used by the schema, unknown formats are accepted
+func checkFormat(format, value string) string {
+	switch format {
+	case "uri":
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "is not an absolute URL"
+		}
+	case "uri-reference":
+		if _, err := url.Parse(value); err != nil {
+			return "is not a valid URL or path"
+		}
+	case "positive-duration":
+		if d, err := time.ParseDuration(value); err == nil && d <= 0 {
+			return "is not a positive duration"
+		}
+	case "regex":
+		if _, err := regexp.Compile(value); err != nil {
+			return "is not a valid regular expression: " + err.Error()
+		}
+	}
+	return ""
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	values := make([]string, 0, len(enum))
+	for _, e := range enum {
+		values = append(values, fmt.Sprint(e))
+	}
+	return strings.Join(values, ", ")
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
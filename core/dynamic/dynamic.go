@@ -0,0 +1,149 @@
+// Package dynamic serves WSDL operations without generated code. The WSDL of a
+// route is loaded when the server starts and SOAP responses are converted into
+// generic values shaped by the XSD model of the response element.
+package dynamic
+
+import (
+	"fmt"
+	"strconv"
+
+	"rest-to-soap/core/build/generators"
+	"rest-to-soap/core/config"
+	"rest-to-soap/core/schema"
+	"rest-to-soap/core/soapenv"
+	"rest-to-soap/core/xmltree"
+)
+
+// xsiNamespace is the XML Schema instance namespace declaring xsi:nil
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// Operation is a WSDL operation loaded at runtime
+type Operation struct {
+	// Route is the route configuration completed with the WSDL binding
+	Route          config.RouteConfig
+	RequestSchema  *schema.Element
+	ResponseSchema *schema.Element
+}
+
+// Load reads the WSDL of a route and builds the models of its operation
+func Load(route config.RouteConfig) (*Operation, error) {
+	if route.WSDLURL == "" || route.SoapAction == "" {
+		return nil, fmt.Errorf("route %s: dynamic mode requires wsdl_url and soap_action", route.Key())
+	}
+
+	route, err := generators.ApplyOperationBinding(route)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", route.Key(), err)
+	}
+
+	requestSchema, err := generators.ExtractRequestSchema(route.WSDLURL, route.SoapAction)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", route.Key(), err)
+	}
+
+	responseSchema, err := generators.ExtractResponseSchema(route.WSDLURL, route.SoapAction)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", route.Key(), err)
+	}
+
+	return &Operation{
+		Route:          route,
+		RequestSchema:  requestSchema,
+		ResponseSchema: responseSchema,
+	}, nil
+}
+
+// Parse converts a SOAP response envelope into the generic values of its
+// response element, the counterpart of the generated `<Op>Parse` functions
+func (o *Operation) Parse(xmlData []byte) (interface{}, error) {
+	envelope, err := xmltree.Decode(xmlData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal XML: %w", err)
+	}
+	if envelope.Name.Local != "Envelope" || !soapenv.IsEnvelopeNamespace(envelope.Name.Space) {
+		return nil, fmt.Errorf("unexpected SOAP envelope %s %s", envelope.Name.Space, envelope.Name.Local)
+	}
+
+	response := envelope.Find("Body", o.ResponseSchema.Name)
+	if response == nil {
+		return nil, fmt.Errorf("response element %s not found in SOAP body", o.ResponseSchema.Name)
+	}
+	return Convert(response, o.ResponseSchema), nil
+}
+
+// Convert turns an XML element into generic values following its XSD model.
+// Complex elements become maps keyed by element name, repeated elements are
+// always lists, and simple values are typed: integers, numbers and booleans
+// become JSON numbers and booleans. Elements missing from the model are kept
+// as untyped values.
+func Convert(node *xmltree.Node, elem *schema.Element) interface{} {
+	if elem == nil {
+		return node.Value()
+	}
+	if isNil(node) {
+		return nil
+	}
+	if len(elem.Children) == 0 {
+		return scalar(node.Text, elem.Type)
+	}
+
+	out := make(map[string]interface{}, len(elem.Children))
+	known := make(map[string]bool, len(elem.Children))
+	for _, child := range elem.Children {
+		known[child.Name] = true
+		nodes := node.ChildrenNamed(child.Name)
+
+		if child.MaxOccurs != 1 {
+			items := make([]interface{}, 0, len(nodes))
+			for _, n := range nodes {
+				items = append(items, Convert(n, child))
+			}
+			out[child.Name] = items
+			continue
+		}
+		if len(nodes) > 0 {
+			out[child.Name] = Convert(nodes[0], child)
+		}
+	}
+
+	for _, child := range node.Children {
+		if !known[child.Name.Local] {
+			out[child.Name.Local] = child.Value()
+		}
+	}
+	return out
+}
+
+// isNil reports whether an element is marked xsi:nil="true"
+func isNil(node *xmltree.Node) bool {
+	for _, attr := range node.Attrs {
+		if attr.Name.Space == xsiNamespace && attr.Name.Local == "nil" {
+			return attr.Value == "true" || attr.Value == "1"
+		}
+	}
+	return false
+}
+
+// scalar types the text of a simple element by its XSD built-in type, values
+// that do not parse are kept as strings
+func scalar(text, xsdType string) interface{} {
+	switch xsdType {
+	case "int", "integer", "long", "short", "byte",
+		"nonNegativeInteger", "positiveInteger", "unsignedInt", "unsignedLong", "unsignedShort":
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n
+		}
+	case "decimal", "float", "double":
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		switch text {
+		case "true", "1":
+			return true
+		case "false", "0":
+			return false
+		}
+	}
+	return text
+}
@@ -0,0 +1,162 @@
+// Package logging keeps configuration secrets out of the logs
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"rest-to-soap/core/config"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redactor replaces known secrets in log entries
+type Redactor struct {
+	mu       sync.Mutex
+	secrets  map[string]bool
+	replacer atomic.Pointer[strings.Replacer]
+}
+
+// NewRedactor creates a redactor without secrets
+func NewRedactor() *Redactor {
+	return &Redactor{secrets: make(map[string]bool)}
+}
+
+// Add registers secrets. Secrets are never removed so entries logged by
+// requests still running on a previous configuration stay redacted.
+func (r *Redactor) Add(secrets []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changed := false
+	for _, secret := range secrets {
+		if secret != "" && !r.secrets[secret] {
+			r.secrets[secret] = true
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	// Secrets are also matched in their JSON escaped form, which is how they
+	// appear in structured fields
+	var forms []string
+	for secret := range r.secrets {
+		forms = append(forms, secret)
+		if escaped := jsonEscape(secret); escaped != secret {
+			forms = append(forms, escaped)
+		}
+	}
+	// Longest first so a secret containing another one is replaced as a whole
+	sort.Slice(forms, func(i, j int) bool { return len(forms[i]) > len(forms[j]) })
+
+	pairs := make([]string, 0, 2*len(forms))
+	for _, form := range forms {
+		pairs = append(pairs, form, config.Redacted)
+	}
+	r.replacer.Store(strings.NewReplacer(pairs...))
+}
+
+// Redact replaces the registered secrets in s
+func (r *Redactor) Redact(s string) string {
+	replacer := r.replacer.Load()
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// Option wraps the core of a logger so every entry is redacted
+func (r *Redactor) Option() zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &redactingCore{Core: core, redactor: r}
+	})
+}
+
+// redactingCore redacts the message and fields of entries before they reach
+// the wrapped core
+type redactingCore struct {
+	zapcore.Core
+	redactor *Redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.redactFields(fields)), redactor: c.redactor}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if c.redactor.replacer.Load() != nil {
+		entry.Message = c.redactor.Redact(entry.Message)
+		fields = c.redactFields(fields)
+	}
+	return c.Core.Write(entry, fields)
+}
+
+func (c *redactingCore) redactFields(fields []zapcore.Field) []zapcore.Field {
+	if c.redactor.replacer.Load() == nil {
+		return fields
+	}
+
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		redacted[i] = c.redactField(field)
+	}
+	return redacted
+}
+
+func (c *redactingCore) redactField(field zapcore.Field) zapcore.Field {
+	switch field.Type {
+	case zapcore.StringType:
+		field.String = c.redactor.Redact(field.String)
+	case zapcore.ByteStringType:
+		return zap.String(field.Key, c.redactor.Redact(string(field.Interface.([]byte))))
+	case zapcore.ErrorType:
+		return zap.String(field.Key, c.redactor.Redact(field.Interface.(error).Error()))
+	case zapcore.StringerType:
+		return zap.String(field.Key, c.redactor.Redact(field.Interface.(fmt.Stringer).String()))
+	case zapcore.ReflectType:
+		// Structured values are encoded once to find out whether they hold a
+		// secret, values without secrets are logged unchanged
+		data, err := marshal(field.Interface)
+		if err != nil {
+			return field
+		}
+		if out := c.redactor.Redact(string(data)); out != string(data) {
+			return zap.Reflect(field.Key, json.RawMessage(out))
+		}
+	}
+	return field
+}
+
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// jsonEscape returns s as it appears inside a JSON string
+func jsonEscape(s string) string {
+	data, err := marshal(s)
+	if err != nil {
+		return s
+	}
+	return string(data[1 : len(data)-1])
+}
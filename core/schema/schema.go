@@ -0,0 +1,229 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unbounded is the MaxOccurs of elements declared with maxOccurs="unbounded"
+const Unbounded = -1
+
+// Element describes an XSD element of an operation's input message. Simple
+// elements have a Type, the local name of their XSD built-in base type, and
+// complex elements have Children.
+type Element struct {
+	Name      string
+	Type      string
+	MinOccurs int
+	MaxOccurs int
+	Enum      []string
+	Children  []*Element
+}
+
+// FieldError describes why a field of a JSON request does not match the schema
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validate checks a JSON request body against the children of the element:
+// required elements, cardinality, enumerations and the format of simple values.
+// Fields that are not part of the schema are ignored.
+func (e *Element) Validate(body map[string]interface{}) []FieldError {
+	var errs []FieldError
+	e.validateChildren(body, "", &errs)
+	return errs
+}
+
+// Lookup returns the simple element at a dotted path of element names, such
+// as address.zip, to validate values that do not come from the JSON body
+func (e *Element) Lookup(path string) (*Element, error) {
+	current := e
+	for _, name := range strings.Split(path, ".") {
+		var next *Element
+		for _, child := range current.Children {
+			if child.Name == name {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("no element %q in the request schema", path)
+		}
+		current = next
+	}
+	if len(current.Children) > 0 {
+		return nil, fmt.Errorf("element %q is not a simple element", path)
+	}
+	return current, nil
+}
+
+// ValidateValues checks the values of a request parameter, such as a query
+// parameter, against a simple element: cardinality, format and enumerations
+func (e *Element) ValidateValues(field string, values []string) []FieldError {
+	var errs []FieldError
+	switch {
+	case len(values) == 0 && e.MinOccurs > 0:
+		errs = append(errs, FieldError{Field: field, Message: "is required"})
+	case len(values) < e.MinOccurs:
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must occur at least %d times", e.MinOccurs)})
+	case e.MaxOccurs != Unbounded && len(values) > e.MaxOccurs:
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must occur at most %d times", e.MaxOccurs)})
+	default:
+		for _, value := range values {
+			e.validateValue(value, field, &errs)
+		}
+	}
+	return errs
+}
+
+func (e *Element) validateChildren(obj map[string]interface{}, path string, errs *[]FieldError) {
+	for _, child := range e.Children {
+		field := child.Name
+		if path != "" {
+			field = path + "." + child.Name
+		}
+
+		value, present := obj[child.Name]
+		items, isList := value.([]interface{})
+		count := 0
+		switch {
+		case !present || value == nil:
+		case isList:
+			count = len(items)
+		default:
+			items = []interface{}{value}
+			count = 1
+		}
+
+		if count < child.MinOccurs {
+			if child.MinOccurs == 1 {
+				*errs = append(*errs, FieldError{Field: field, Message: "is required"})
+			} else {
+				*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf("must occur at least %d times", child.MinOccurs)})
+			}
+			continue
+		}
+
+		if child.MaxOccurs == 1 && isList {
+			*errs = append(*errs, FieldError{Field: field, Message: "must be a single value, not a list"})
+			continue
+		}
+		if child.MaxOccurs != Unbounded && count > child.MaxOccurs {
+			*errs = append(*errs, FieldError{Field: field, Message: fmt.Sprintf("must occur at most %d times", child.MaxOccurs)})
+			continue
+		}
+
+		for i, item := range items {
+			itemField := field
+			if isList {
+				itemField = fmt.Sprintf("%s[%d]", field, i)
+			}
+			child.validateValue(item, itemField, errs)
+		}
+	}
+}
+
+func (e *Element) validateValue(value interface{}, field string, errs *[]FieldError) {
+	if len(e.Children) > 0 {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			*errs = append(*errs, FieldError{Field: field, Message: "must be an object"})
+			return
+		}
+		e.validateChildren(obj, field, errs)
+		return
+	}
+
+	text, ok := scalarText(value)
+	if !ok {
+		*errs = append(*errs, FieldError{Field: field, Message: "must be a scalar value"})
+		return
+	}
+
+	if msg := checkFormat(e.Type, value, text); msg != "" {
+		*errs = append(*errs, FieldError{Field: field, Message: msg})
+		return
+	}
+
+	if len(e.Enum) > 0 && !contains(e.Enum, text) {
+		*errs = append(*errs, FieldError{Field: field, Message: "must be one of " + strings.Join(e.Enum, ", ")})
+	}
+}
+
+// scalarText returns the textual form of a JSON scalar as it would appear in XML
+func scalarText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case json.Number:
+		return v.String(), true
+	}
+	return "", false
+}
+
+// checkFormat validates a simple value against its XSD built-in type
+func checkFormat(xsdType string, value interface{}, text string) string {
+	switch xsdType {
+	case "int", "integer", "long", "short", "byte",
+		"nonNegativeInteger", "positiveInteger", "unsignedInt", "unsignedLong", "unsignedShort":
+		if f, ok := value.(float64); ok {
+			if f != math.Trunc(f) {
+				return "must be an integer"
+			}
+			return ""
+		}
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			return "must be an integer"
+		}
+	case "decimal", "float", "double":
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return "must be a number"
+		}
+	case "boolean":
+		switch text {
+		case "true", "false", "1", "0":
+		default:
+			return "must be a boolean"
+		}
+	case "date":
+		if _, err := time.Parse("2006-01-02", text); err != nil {
+			return "must be a date (YYYY-MM-DD)"
+		}
+	case "dateTime":
+		if !parsesAs(text, time.RFC3339Nano, "2006-01-02T15:04:05") {
+			return "must be a date-time (YYYY-MM-DDThh:mm:ss)"
+		}
+	case "time":
+		if !parsesAs(text, "15:04:05", "15:04:05Z07:00") {
+			return "must be a time (hh:mm:ss)"
+		}
+	}
+	return ""
+}
+
+func parsesAs(text string, layouts ...string) bool {
+	for _, layout := range layouts {
+		if _, err := time.Parse(layout, text); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
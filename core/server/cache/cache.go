@@ -0,0 +1,114 @@
+// Package cache stores SOAP responses for the response cache of routes
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Entry is a cached SOAP response
+type Entry struct {
+	// Body is the SOAP response envelope
+	Body []byte `json:"body"`
+	// Stored is when the response was received
+	Stored time.Time `json:"stored"`
+	// Expires is when the entry stops being fresh
+	Expires time.Time `json:"expires"`
+	// StaleUntil is when the entry may no longer be served while it is
+	// revalidated, the backend may drop the entry from then on
+	StaleUntil time.Time `json:"stale_until"`
+}
+
+// Fresh reports whether the entry can be served without revalidation
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// Usable reports whether the entry can be served, fresh or stale
+func (e *Entry) Usable(now time.Time) bool {
+	return now.Before(e.StaleUntil)
+}
+
+// Cache is a store of SOAP responses. Implementations backed by a shared
+// store let several proxy instances use the same responses, they must be
+// safe for concurrent use.
+type Cache interface {
+	// Get returns the entry stored under key, nil when there is none
+	Get(ctx context.Context, key string) (*Entry, error)
+	// Set stores an entry under key, at least until its StaleUntil time
+	Set(ctx context.Context, key string, entry *Entry) error
+}
+
+// Memory is an in-memory Cache holding a bounded number of entries, the
+// least recently used entry is evicted first
+type Memory struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryItem struct {
+	key   string
+	entry *Entry
+}
+
+// NewMemory creates an in-memory cache holding up to maxEntries entries
+func NewMemory(maxEntries int) *Memory {
+	return &Memory{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Get implements Cache, entries past their StaleUntil time are dropped
+func (m *Memory) Get(_ context.Context, key string) (*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	item := elem.Value.(*memoryItem)
+	if !item.entry.Usable(time.Now()) {
+		m.remove(elem)
+		return nil, nil
+	}
+	m.lru.MoveToFront(elem)
+	return item.entry, nil
+}
+
+// Set implements Cache
+func (m *Memory) Set(_ context.Context, key string, entry *Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.entries[key]; ok {
+		elem.Value.(*memoryItem).entry = entry
+		m.lru.MoveToFront(elem)
+		return nil
+	}
+
+	m.entries[key] = m.lru.PushFront(&memoryItem{key: key, entry: entry})
+	for m.maxEntries > 0 && m.lru.Len() > m.maxEntries {
+		m.remove(m.lru.Back())
+	}
+	return nil
+}
+
+// Len returns the number of entries in the cache
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+func (m *Memory) remove(elem *list.Element) {
+	m.lru.Remove(elem)
+	delete(m.entries, elem.Value.(*memoryItem).key)
+}
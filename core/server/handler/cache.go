@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"rest-to-soap/core/config"
+	"rest-to-soap/core/server/cache"
+
+	"go.uber.org/zap"
+)
+
+// defaultCacheMaxEntries bounds the in-memory cache when the server sets no size
+const defaultCacheMaxEntries = 10000
+
+// Cache results reported in the X-Cache header and the metrics
+const (
+	cacheHit   = "hit"
+	cacheStale = "stale"
+	cacheMiss  = "miss"
+	// cacheCoalesced is only reported in X-Cache, for a response fetched by
+	// an identical request in flight
+	cacheCoalesced = "coalesced"
+)
+
+// cachePolicy is the compiled response cache configuration of a route
+type cachePolicy struct {
+	config.CacheConfig
+}
+
+// newCachePolicy returns the cache policy of a route, nil when its responses
+// are not cached
+func newCachePolicy(route config.RouteConfig) *cachePolicy {
+	if route.Cache == nil || route.Cache.TTL <= 0 {
+		return nil
+	}
+	return &cachePolicy{CacheConfig: *route.Cache}
+}
+
+// key returns the cache key of a request: a hash of the selected request
+// values, or of the rendered SOAP envelope when the route selects none
+func (p *cachePolicy) key(route config.RouteConfig, envelope []byte, data map[string]interface{}) string {
+	h := sha256.New()
+	if len(p.Key) == 0 {
+		h.Write(envelope)
+	}
+	for _, name := range p.Key {
+		fmt.Fprintf(h, "%s=%v\x00", name, lookupValue(data, name))
+	}
+	return route.Key() + " " + hex.EncodeToString(h.Sum(nil))
+}
+
+// lookupValue returns a value of the template data by its dotted name, such
+// as path.iso or headers.Accept-Language
+func lookupValue(data map[string]interface{}, name string) interface{} {
+	source, field, _ := strings.Cut(name, ".")
+	switch values := data[source].(type) {
+	case map[string]string:
+		if source == "headers" {
+			field = http.CanonicalHeaderKey(field)
+		}
+		return values[field]
+	case map[string]interface{}:
+		return values[field]
+	}
+	return nil
+}
+
+// entry builds the cache entry of a SOAP response received at now
+func (p *cachePolicy) entry(respBody []byte, now time.Time) *cache.Entry {
+	expires := now.Add(p.TTL)
+	return &cache.Entry{
+		Body:       respBody,
+		Stored:     now,
+		Expires:    expires,
+		StaleUntil: expires.Add(p.StaleWhileRevalidate),
+	}
+}
+
+// cacheControl returns the Cache-Control header of a response served from entry
+func (p *cachePolicy) cacheControl(entry *cache.Entry, now time.Time) string {
+	maxAge := int(entry.Expires.Sub(now).Round(time.Second).Seconds())
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	value := "max-age=" + strconv.Itoa(maxAge)
+	if p.StaleWhileRevalidate > 0 {
+		value += ", stale-while-revalidate=" + strconv.Itoa(int(p.StaleWhileRevalidate.Seconds()))
+	}
+	return value
+}
+
+// SetCache replaces the in-memory response cache, e.g. by a cache shared
+// between instances. It must be called before the handler serves requests.
+func (h *Handler) SetCache(c cache.Cache) {
+	h.cache = c
+}
+
+// serveCached answers a request from the response cache and reports whether
+// it did. Stale entries are served while a background call refreshes them.
+func (h *Handler) serveCached(w http.ResponseWriter, r *http.Request, rt *route, key string, envelope []byte, obs *observation) bool {
+	entry, err := h.cache.Get(r.Context(), key)
+	if err != nil {
+		h.logger.Warn("Failed to read the response cache", zap.Error(err))
+		return false
+	}
+
+	now := time.Now()
+	if entry == nil || !entry.Usable(now) {
+		h.observeCache(obs, cacheMiss)
+		return false
+	}
+
+	response, err := renderSOAPResponse(rt.handler, entry.Body)
+	if err != nil {
+		h.logger.Warn("Ignoring cached response", zap.Error(err))
+		return false
+	}
+
+	result := cacheHit
+	if !entry.Fresh(now) {
+		result = cacheStale
+		h.revalidate(rt, key, envelope, obs)
+	}
+	h.observeCache(obs, result)
+	obs.upstreamStatus = "cache"
+
+	if err := writeResponse(w, r, rt, response, entry, result); err != nil {
+		h.logger.Error("Failed to write cached response", zap.Error(err))
+	}
+	return true
+}
+
+// storeCached stores a SOAP response in the response cache and returns its entry
+func (h *Handler) storeCached(ctx context.Context, rt *route, key string, respBody []byte) *cache.Entry {
+	entry := rt.cache.entry(respBody, time.Now())
+	if err := h.cache.Set(ctx, key, entry); err != nil {
+		h.logger.Warn("Failed to write the response cache", zap.Error(err))
+	}
+	return entry
+}
+
+// revalidate refreshes a stale cache entry in the background, at most one
+// refresh per key runs at a time. The refresh takes a worker and is skipped
+// when none is free, the entry is then refreshed by a later request.
+func (h *Handler) revalidate(rt *route, key string, envelope []byte, obs *observation) {
+	if _, running := h.revalidating.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+
+	background := &observation{route: obs.route, action: obs.action, upstreamStatus: "none"}
+	started := h.pool.TryGo(func() {
+		defer h.revalidating.Delete(key)
+
+		respBody, err := h.fetch(context.Background(), rt, envelope, background)
+		if err == nil {
+			_, err = renderSOAPResponse(rt.handler, respBody)
+		}
+		if err != nil {
+			h.logger.Warn("Failed to revalidate cached response",
+				zap.String("route", rt.handler.RouteConfig.Key()),
+				zap.Error(err),
+			)
+			return
+		}
+		h.storeCached(context.Background(), rt, key, respBody)
+	})
+	if !started {
+		h.revalidating.Delete(key)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header matches an ETag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"rest-to-soap/core/server/cache"
+)
+
+// agingCache is an in-memory cache whose entries can be made stale
+type agingCache struct {
+	*cache.Memory
+	keys sync.Map
+}
+
+func (c *agingCache) Set(ctx context.Context, key string, entry *cache.Entry) error {
+	c.keys.Store(key, struct{}{})
+	return c.Memory.Set(ctx, key, entry)
+}
+
+// expire turns every entry stale, still usable while it is revalidated
+func (c *agingCache) expire(t *testing.T) {
+	t.Helper()
+	now := time.Now()
+	c.keys.Range(func(key, _ interface{}) bool {
+		entry, err := c.Memory.Get(context.Background(), key.(string))
+		if err != nil || entry == nil {
+			t.Fatalf("cache entry %s missing", key)
+		}
+		stale := *entry
+		stale.Expires = now.Add(-time.Second)
+		stale.StaleUntil = now.Add(time.Minute)
+		_ = c.Memory.Set(context.Background(), key.(string), &stale)
+		return true
+	})
+}
+
+// newCachingHandler builds a test handler caching the flag route and returns
+// it with its cache
+func newCachingHandler(t *testing.T, endpoint string, server map[string]interface{}) (*Handler, *agingCache) {
+	t.Helper()
+	h := newTestHandler(t, endpoint, server, map[string]interface{}{
+		"cache": map[string]interface{}{"ttl": "1m", "stale_while_revalidate": "1m"},
+	})
+	c := &agingCache{Memory: cache.NewMemory(10)}
+	h.SetCache(c)
+	return h, c
+}
+
+// revalidations returns the number of keys being revalidated
+func revalidations(h *Handler) int {
+	n := 0
+	h.revalidating.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func TestServeHTTPCacheHit(t *testing.T) {
+	backend := newUpstream(t)
+	h, _ := newCachingHandler(t, backend.URL, nil)
+
+	miss := serve(h, http.MethodGet, flagPath, nil)
+	if miss.Code != http.StatusOK || miss.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first request = %d %q, want 200 MISS", miss.Code, miss.Header().Get("X-Cache"))
+	}
+	hit := serve(h, http.MethodGet, flagPath, nil)
+	if hit.Code != http.StatusOK || hit.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("second request = %d %q, want 200 HIT", hit.Code, hit.Header().Get("X-Cache"))
+	}
+	if backend.calls.Load() != 1 {
+		t.Fatalf("backend called %d times, want 1", backend.calls.Load())
+	}
+	if hit.Body.String() != miss.Body.String() || hit.Header().Get("ETag") != miss.Header().Get("ETag") {
+		t.Fatalf("cached response %q (%s), want %q (%s)", hit.Body, hit.Header().Get("ETag"), miss.Body, miss.Header().Get("ETag"))
+	}
+	if got := hit.Header().Get("Cache-Control"); got != "max-age=60, stale-while-revalidate=60" {
+		t.Fatalf("Cache-Control = %q", got)
+	}
+	if got := hit.Header().Get("Age"); got != "0" {
+		t.Fatalf("Age = %q, want 0", got)
+	}
+}
+
+func TestServeHTTPStaleWhileRevalidate(t *testing.T) {
+	backend := newUpstream(t)
+	h, c := newCachingHandler(t, backend.URL, nil)
+
+	serve(h, http.MethodGet, flagPath, nil)
+	c.expire(t)
+
+	stale := serve(h, http.MethodGet, flagPath, nil)
+	if stale.Code != http.StatusOK || stale.Header().Get("X-Cache") != "STALE" {
+		t.Fatalf("request = %d %q, want 200 STALE", stale.Code, stale.Header().Get("X-Cache"))
+	}
+	waitFor(t, func() bool { return backend.calls.Load() == 2 && revalidations(h) == 0 })
+
+	if got := serve(h, http.MethodGet, flagPath, nil).Header().Get("X-Cache"); got != "HIT" {
+		t.Fatalf("X-Cache = %q after the revalidation, want HIT", got)
+	}
+	if backend.calls.Load() != 2 {
+		t.Fatalf("backend called %d times, want 2", backend.calls.Load())
+	}
+}
+
+func TestServeHTTPRevalidateWithoutWorker(t *testing.T) {
+	backend := newUpstream(t)
+	h, c := newCachingHandler(t, backend.URL, map[string]interface{}{"workers": 1, "queue_size": 1})
+
+	serve(h, http.MethodGet, flagPath, nil)
+	c.expire(t)
+
+	release := fillPool(t, h.pool, 1, 0)
+	stale := serve(h, http.MethodGet, flagPath, nil)
+	if stale.Code != http.StatusOK || stale.Header().Get("X-Cache") != "STALE" {
+		t.Fatalf("request = %d %q, want 200 STALE", stale.Code, stale.Header().Get("X-Cache"))
+	}
+	if n := revalidations(h); n != 0 {
+		t.Fatalf("%d revalidations marked running, want the skipped one cleared", n)
+	}
+	release()
+	waitFor(t, func() bool { return h.pool.Active() == 0 })
+	if backend.calls.Load() != 1 {
+		t.Fatalf("backend called %d times, want no revalidation without a worker", backend.calls.Load())
+	}
+
+	// A later request refreshes the entry once a worker is free
+	serve(h, http.MethodGet, flagPath, nil)
+	waitFor(t, func() bool { return backend.calls.Load() == 2 && revalidations(h) == 0 })
+}
+
+func TestServeHTTPNotModified(t *testing.T) {
+	backend := newUpstream(t)
+	h, c := newCachingHandler(t, backend.URL, nil)
+
+	first := serve(h, http.MethodGet, flagPath, http.Header{"If-None-Match": {"*"}})
+	if first.Code != http.StatusOK || first.Body.Len() == 0 {
+		t.Fatalf("fetched response = %d with %d bytes, want the full 200 response", first.Code, first.Body.Len())
+	}
+	etag := first.Header().Get("ETag")
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		stale       bool
+		wantStatus  int
+	}{
+		{name: "hit with matching ETag", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "hit with other ETag", ifNoneMatch: `"other"`, wantStatus: http.StatusOK},
+		{name: "hit without If-None-Match", wantStatus: http.StatusOK},
+		{name: "stale with matching ETag", ifNoneMatch: `"other", W/` + etag, stale: true, wantStatus: http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.stale {
+				c.expire(t)
+			}
+			var header http.Header
+			if tt.ifNoneMatch != "" {
+				header = http.Header{"If-None-Match": {tt.ifNoneMatch}}
+			}
+			w := serve(h, http.MethodGet, flagPath, header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Fatalf("304 response has a body %q", w.Body)
+			}
+			if w.Header().Get("ETag") != etag {
+				t.Fatalf("ETag = %q, want %q", w.Header().Get("ETag"), etag)
+			}
+		})
+	}
+	waitFor(t, func() bool { return revalidations(h) == 0 })
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`*`, true},
+		{`"x", "abc"`, true},
+		{`"x",W/"abc"`, true},
+		{`"abcd"`, false},
+		{`abc`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, `"abc"`); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.ifNoneMatch, got, tt.want)
+		}
+	}
+}
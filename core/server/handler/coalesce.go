@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"rest-to-soap/core/config"
+	"rest-to-soap/core/server/cache"
+)
+
+// coalesceUnsafe reports whether a route coalesces calls that may change
+// state, so that identical concurrent requests are applied only once
+func coalesceUnsafe(route config.RouteConfig) bool {
+	return route.Coalesce && !route.Idempotent && route.HTTPMethod() != http.MethodGet
+}
+
+// flight is an upstream call shared by concurrent requests rendering the
+// same SOAP envelope
+type flight struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+	// waiters counts the requests waiting for the call, the call is
+	// cancelled when the last one leaves before it finished
+	waiters int
+
+	// obs collects what happened upstream, it is copied to every waiter
+	obs      observation
+	response []byte
+	entry    *cache.Entry
+	err      error
+}
+
+// flights tracks the shared upstream calls in flight by key
+type flights struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+// callFunc makes an upstream call and returns the rendered REST response
+type callFunc func(ctx context.Context, obs *observation) ([]byte, *cache.Entry, error)
+
+// do runs call once for all concurrent requests with the same key and returns
+// its result to each of them. The call does not inherit the cancellation of
+// the request that started it: a request whose context is done stops waiting
+// while the call goes on for the others. shared is false for the request that
+// started the call.
+func (f *flights) do(ctx context.Context, key string, obs *observation, call callFunc) (response []byte, entry *cache.Entry, shared bool, err error) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*flight)
+	}
+	c, shared := f.calls[key]
+	if shared {
+		c.waiters++
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &flight{
+			done:    make(chan struct{}),
+			cancel:  cancel,
+			waiters: 1,
+			obs:     observation{route: obs.route, action: obs.action, upstreamStatus: "none"},
+		}
+		f.calls[key] = c
+		go f.run(callCtx, key, c, call)
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-c.done:
+		obs.upstreamStatus = c.obs.upstreamStatus
+		return c.response, c.entry, shared, c.err
+	case <-ctx.Done():
+		f.leave(key, c)
+		return nil, nil, shared, ctx.Err()
+	}
+}
+
+// run makes the shared call and wakes up its waiters
+func (f *flights) run(ctx context.Context, key string, c *flight, call callFunc) {
+	defer c.cancel()
+	c.response, c.entry, c.err = call(ctx, &c.obs)
+
+	f.mu.Lock()
+	if f.calls[key] == c {
+		delete(f.calls, key)
+	}
+	f.mu.Unlock()
+	close(c.done)
+}
+
+// leave removes a waiter that gave up and cancels the call when nobody is
+// left waiting for it
+func (f *flights) leave(key string, c *flight) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+	if f.calls[key] == c {
+		delete(f.calls, key)
+	}
+	c.cancel()
+}
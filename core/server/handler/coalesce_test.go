@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"rest-to-soap/core/server/cache"
+)
+
+// waiting returns the number of requests waiting for shared calls
+func waiting(h *Handler) int {
+	h.flights.mu.Lock()
+	defer h.flights.mu.Unlock()
+	n := 0
+	for _, c := range h.flights.calls {
+		n += c.waiters
+	}
+	return n
+}
+
+// serveAsync sends a request in the background, the response is available
+// once the returned channel is closed
+func serveAsync(ctx context.Context, h *Handler) (*httptest.ResponseRecorder, <-chan struct{}) {
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, flagPath, nil).WithContext(ctx))
+	}()
+	return w, done
+}
+
+func TestServeHTTPCoalesce(t *testing.T) {
+	const followers = 3
+
+	tests := []struct {
+		name string
+		// cancelLeader cancels the request that started the call while the
+		// others wait for it
+		cancelLeader bool
+	}{
+		{name: "shares one call"},
+		{name: "cancelled leader", cancelLeader: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newUpstream(t)
+			backend.gate = make(chan struct{})
+			h := newTestHandler(t, backend.URL, nil, map[string]interface{}{
+				"coalesce": true,
+				"cache":    map[string]interface{}{"ttl": "1m"},
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			leader, leaderDone := serveAsync(ctx, h)
+			waitFor(t, func() bool { return backend.calls.Load() == 1 })
+
+			var responses []*httptest.ResponseRecorder
+			var wg sync.WaitGroup
+			for i := 0; i < followers; i++ {
+				w, done := serveAsync(context.Background(), h)
+				responses = append(responses, w)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-done
+				}()
+			}
+			waitFor(t, func() bool { return waiting(h) == followers+1 })
+
+			if tt.cancelLeader {
+				cancel()
+				<-leaderDone
+				if leader.Code != statusClientClosedRequest {
+					t.Fatalf("leader status = %d, want %d", leader.Code, statusClientClosedRequest)
+				}
+			}
+			close(backend.gate)
+			wg.Wait()
+			<-leaderDone
+
+			if !tt.cancelLeader {
+				if leader.Code != http.StatusOK || leader.Header().Get("X-Cache") != "MISS" {
+					t.Fatalf("leader = %d %q, want 200 MISS", leader.Code, leader.Header().Get("X-Cache"))
+				}
+			}
+			for i, w := range responses {
+				if w.Code != http.StatusOK || w.Header().Get("X-Cache") != "COALESCED" {
+					t.Fatalf("follower %d = %d %q, want 200 COALESCED", i, w.Code, w.Header().Get("X-Cache"))
+				}
+				if !strings.Contains(w.Body.String(), "flag.jpg") {
+					t.Fatalf("follower %d body = %q, want the shared response", i, w.Body)
+				}
+			}
+			if backend.calls.Load() != 1 {
+				t.Fatalf("backend called %d times, want 1", backend.calls.Load())
+			}
+			if n := waiting(h); n != 0 {
+				t.Fatalf("%d requests still waiting", n)
+			}
+		})
+	}
+}
+
+func TestFlightsCancelledWithoutWaiters(t *testing.T) {
+	var f flights
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	call := func(ctx context.Context, obs *observation) ([]byte, *cache.Entry, error) {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil, nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, _, shared, err := f.do(ctx, "key", &observation{}, call); shared || err != context.Canceled {
+		t.Fatalf("do() = shared %v, error %v, want the cancellation of the leader", shared, err)
+	}
+	if err := <-stopped; err != context.Canceled {
+		t.Fatalf("call context error = %v, want it cancelled once nobody waits", err)
+	}
+}
+
+func TestNewHandlerCoalesceMethods(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   map[string]interface{}
+		wantErr string
+	}{
+		{name: "GET", route: map[string]interface{}{"coalesce": true}},
+		{name: "idempotent POST", route: map[string]interface{}{"method": "POST", "coalesce": true, "idempotent": true}},
+		{
+			name:    "POST",
+			route:   map[string]interface{}{"method": "POST", "coalesce": true},
+			wantErr: "sets coalesce but is neither GET nor marked idempotent",
+		},
+		{
+			name:    "DELETE",
+			route:   map[string]interface{}{"method": "DELETE", "coalesce": true},
+			wantErr: "sets coalesce but is neither GET nor marked idempotent",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadTestHandler(t, "http://backend.internal/countryinfo", nil, tt.route)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("NewHandler() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewHandler() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"rest-to-soap/core/config"
+	"rest-to-soap/core/soapenv"
+	"rest-to-soap/core/xmltree"
+)
+
+// SoapFault represents a SOAP fault response
+type SoapFault struct {
+	Code string
+	// Subcodes are the SOAP 1.2 subcode values, outermost first
+	Subcodes []string
+	String   string
+	Actor    string
+	Detail   *xmltree.Node
+}
+
+func (f *SoapFault) Error() string {
+	return f.String
+}
+
+// DetailName returns the local name of the first element of the fault detail
+func (f *SoapFault) DetailName() string {
+	if f.Detail == nil || len(f.Detail.Children) == 0 {
+		return ""
+	}
+	return f.Detail.Children[0].Name.Local
+}
+
+// DetailValue returns the fault detail as JSON-friendly values, nil without detail
+func (f *SoapFault) DetailValue() interface{} {
+	if f.Detail == nil || (len(f.Detail.Children) == 0 && f.Detail.Text == "") {
+		return nil
+	}
+	return f.Detail.Value()
+}
+
+// parseFault extracts the SOAP fault of a response envelope, nil when there is none.
+// Both SOAP 1.1 (faultcode/faultstring) and SOAP 1.2 (Code/Reason) faults are understood.
+func parseFault(respBody []byte) *SoapFault {
+	envelope, err := xmltree.Decode(respBody)
+	if err != nil || envelope.Name.Local != "Envelope" || !soapenv.IsEnvelopeNamespace(envelope.Name.Space) {
+		return nil
+	}
+	fault := envelope.Find("Body", "Fault")
+	if fault == nil {
+		return nil
+	}
+
+	if envelope.Name.Space == soapenv.Namespace12 {
+		return parseFault12(fault)
+	}
+	return &SoapFault{
+		Code:   fault.ChildText("faultcode"),
+		String: fault.ChildText("faultstring"),
+		Actor:  fault.ChildText("faultactor"),
+		Detail: fault.Child("detail"),
+	}
+}
+
+// parseFault12 reads a SOAP 1.2 fault. Nested subcodes are collected from the
+// outermost to the innermost and the first reason text is used as fault string.
+func parseFault12(fault *xmltree.Node) *SoapFault {
+	code := fault.Child("Code")
+	f := &SoapFault{
+		Code:   code.ChildText("Value"),
+		String: fault.Child("Reason").ChildText("Text"),
+		Actor:  fault.ChildText("Role"),
+		Detail: fault.Child("Detail"),
+	}
+	if f.Actor == "" {
+		f.Actor = fault.ChildText("Node")
+	}
+	for sub := code.Child("Subcode"); sub != nil; sub = sub.Child("Subcode") {
+		f.Subcodes = append(f.Subcodes, sub.ChildText("Value"))
+	}
+	return f
+}
+
+func processResponseError(respBody []byte, statusCode int) error {
+	if fault := parseFault(respBody); fault != nil {
+		return fault
+	}
+	return &upstreamError{status: statusCode, body: respBody}
+}
+
+// upstreamError is a failed SOAP call that is not a SOAP fault: the backend
+// could not be reached or timed out, or it answered an error status without a
+// fault or a response that does not parse. The response body is logged and
+// never returned to clients.
+type upstreamError struct {
+	// status is the HTTP status of the response, 0 when there was none
+	status int
+	body   []byte
+	err    error
+}
+
+func (e *upstreamError) Error() string {
+	if e.err != nil {
+		return "SOAP service call failed: " + e.err.Error()
+	}
+	return fmt.Sprintf("SOAP service returned status %d", e.status)
+}
+
+func (e *upstreamError) Unwrap() error {
+	return e.err
+}
+
+// problem returns the answer to the client, 504 when the call timed out and
+// 502 otherwise
+func (e *upstreamError) problem() *problem {
+	var netErr net.Error
+	switch {
+	case errors.Is(e.err, context.DeadlineExceeded) || errors.As(e.err, &netErr) && netErr.Timeout():
+		return newProblem(http.StatusGatewayTimeout, "SOAP service did not answer in time")
+	case e.status != 0:
+		return newProblem(http.StatusBadGateway, fmt.Sprintf("SOAP service returned status %d", e.status))
+	case e.body != nil:
+		return newProblem(http.StatusBadGateway, "SOAP service returned an invalid response")
+	}
+	return newProblem(http.StatusBadGateway, "SOAP service could not be reached")
+}
+
+// faultRule is a compiled fault mapping of a route
+type faultRule struct {
+	config.FaultMapping
+	match *regexp.Regexp
+}
+
+// compileFaultRules compiles the fault mappings of a route
+func compileFaultRules(route config.RouteConfig) ([]faultRule, error) {
+	rules := make([]faultRule, 0, len(route.Faults))
+	for i, mapping := range route.Faults {
+		if mapping.Status < 400 || mapping.Status > 599 {
+			return nil, fmt.Errorf("route %s: fault mapping %d: status %d is not an error status", route.Key(), i, mapping.Status)
+		}
+		rule := faultRule{FaultMapping: mapping}
+		if mapping.Match != "" {
+			re, err := regexp.Compile(mapping.Match)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: fault mapping %d: %w", route.Key(), i, err)
+			}
+			rule.match = re
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// matches reports whether the fault satisfies every criterion of the rule
+func (r *faultRule) matches(fault *SoapFault) bool {
+	if r.Code != "" && !fault.hasCode(r.Code) {
+		return false
+	}
+	if r.match != nil && !r.match.MatchString(fault.String) {
+		return false
+	}
+	if r.Detail != "" && fault.DetailName() != r.Detail {
+		return false
+	}
+	return true
+}
+
+// hasCode reports whether the fault code or one of its SOAP 1.2 subcodes matches code
+func (f *SoapFault) hasCode(code string) bool {
+	if matchFaultCode(f.Code, code) {
+		return true
+	}
+	for _, sub := range f.Subcodes {
+		if matchFaultCode(sub, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFaultCode compares fault codes by local part, a code also matches its
+// dotted subcodes: `Client` matches `soap:Client` and `soap:Client.Authentication`
+func matchFaultCode(faultCode, code string) bool {
+	faultCode = localName(faultCode)
+	code = localName(code)
+	return faultCode == code || strings.HasPrefix(faultCode, code+".")
+}
+
+// faultProblem builds the problem response of a SOAP fault using the first matching rule.
+// Faults without a matching rule are answered with 500 Internal Server Error.
+func faultProblem(rules []faultRule, fault *SoapFault) *problem {
+	p := newProblem(http.StatusInternalServerError, fault.String)
+	for i := range rules {
+		if !rules[i].matches(fault) {
+			continue
+		}
+		p = newProblem(rules[i].Status, fault.String)
+		if rules[i].Type != "" {
+			p.Type = rules[i].Type
+		}
+		if rules[i].Title != "" {
+			p.Title = rules[i].Title
+		}
+		break
+	}
+
+	p.Fault = &faultInfo{
+		Code:     fault.Code,
+		Subcodes: fault.Subcodes,
+		String:   fault.String,
+		Actor:    fault.Actor,
+		Detail:   fault.DetailValue(),
+	}
+	return p
+}
+
+func localName(qname string) string {
+	if idx := strings.LastIndex(qname, ":"); idx != -1 {
+		return qname[idx+1:]
+	}
+	return qname
+}
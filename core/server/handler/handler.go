@@ -2,16 +2,32 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"rest-to-soap/core/build/generators"
 	"rest-to-soap/core/config"
+	"rest-to-soap/core/dynamic"
+	"rest-to-soap/core/server/cache"
+	"rest-to-soap/core/server/metrics"
 	transport "rest-to-soap/core/server/soap"
 	"rest-to-soap/core/server/wsdl"
+	"rest-to-soap/core/soapenv"
+	"rest-to-soap/core/templating"
 	generated "rest-to-soap/pkg/generated"
 
 	"go.uber.org/zap"
@@ -23,159 +39,814 @@ type RequestBody struct {
 	Data    interface{} `xml:",any"`
 }
 
+// defaultRouteTimeout is used for routes that do not configure a timeout
+const defaultRouteTimeout = 30 * time.Second
+
 // Handler handles HTTP requests and forwards them to SOAP endpoints
 type Handler struct {
-	client               *transport.Client
-	pool                 *Pool
-	logger               *zap.Logger
-	wsdl                 *wsdl.Parser
-	routeHandlerRegistry *generated.RouteRegistry
+	// router is swapped as a whole on reload, requests keep the routes they matched
+	router   atomic.Pointer[router]
+	reloadMu sync.Mutex
+	pool     *Pool
+	logger   *zap.Logger
+	metrics  *metrics.Metrics
+	wsdl     *wsdl.Parser
+	// breakers are kept across reloads so endpoints keep their state
+	breakers *transport.Breakers
+	// cache holds the SOAP responses of cached routes, revalidating the
+	// keys of stale entries being refreshed
+	cache        cache.Cache
+	revalidating sync.Map
+	// flights are the upstream calls shared by coalescing routes
+	flights flights
+}
+
+// NewHandler creates a new request handler. Metrics are optional and may be nil.
+func NewHandler(cfg *config.Config, logger *zap.Logger, m *metrics.Metrics) (*Handler, error) {
+	h := &Handler{
+		logger:  logger,
+		metrics: m,
+		wsdl:    wsdl.NewParser(logger),
+	}
+	h.breakers = transport.NewBreakers(h.breakerChanged)
+
+	router, err := h.buildRouter(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSize := cfg.Server.CacheMaxEntries
+	if cacheSize == 0 {
+		cacheSize = defaultCacheMaxEntries
+	}
+	h.cache = cache.NewMemory(cacheSize)
+
+	h.pool = NewPool(cfg.Server.Workers, cfg.Server.QueueSize, cfg.Server.QueueTimeout)
+	if m != nil {
+		m.RegisterWorkerPool(
+			func() float64 { return float64(h.pool.Size()) },
+			func() float64 { return float64(h.pool.Active()) },
+			func() float64 { return float64(h.pool.Queued()) },
+		)
+	}
+
+	h.router.Store(router)
+	h.startEndpoints(router)
+	return h, nil
 }
 
-// NewHandler creates a new request handler
-func NewHandler(cfg *config.Config, logger *zap.Logger) (*Handler, error) {
+// Reload rebuilds the routes, templates and SOAP clients from a new configuration
+// and swaps them in atomically. In-flight requests finish on the routes they
+// matched. When the configuration is invalid the current routes stay in place.
+// The server section (port, timeouts, worker pool) is only applied at startup.
+func (h *Handler) Reload(cfg *config.Config) error {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+
+	// Dynamic routes read their WSDL again
+	generators.ClearWSDLCache()
+
+	router, err := h.buildRouter(cfg)
+	if err != nil {
+		return err
+	}
+
+	previous := h.router.Swap(router)
+	h.startEndpoints(router)
+	for _, rt := range previous.routes() {
+		rt.endpoints.Stop()
+		rt.client.CloseIdleConnections()
+	}
+
+	h.logger.Info("Routes reloaded", zap.Int("routes", len(router.routes())))
+	return nil
+}
+
+// buildRouter hydrates the route registry of a configuration and compiles its
+// routes. Health checks are not started, see startEndpoints.
+func (h *Handler) buildRouter(cfg *config.Config) (*router, error) {
+	logger := h.logger
 	routeRegistry, err := generated.GenerateRouteRegistry(cfg, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Handler{
-		client:               transport.NewClient(30*time.Second, logger),
-		pool:                 NewPool(),
-		logger:               logger,
-		wsdl:                 wsdl.NewParser(logger),
-		routeHandlerRegistry: &routeRegistry,
-	}, nil
+	// Each route gets its own client so backends with different latency
+	// profiles do not share timeouts or connection pools
+	routes := make([]*route, 0, len(routeRegistry))
+	for _, routeHandler := range routeRegistry {
+		if routeHandler.RouteConfig.Mode == config.ModeDynamic {
+			routeHandler, err = loadDynamicRoute(routeHandler)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if routeHandler.Parser == nil {
+			return nil, fmt.Errorf("route %s has no generated parser, run cmd/build or use \"mode\": \"dynamic\"", routeHandler.RouteConfig.Key())
+		}
+		if routeHandler.RouteConfig.SoapEndpoint != "" && len(routeHandler.RouteConfig.SoapEndpoints) > 0 {
+			return nil, fmt.Errorf("route %s sets both soap_endpoint and soap_endpoints", routeHandler.RouteConfig.Key())
+		}
+		if len(routeHandler.RouteConfig.Endpoints()) == 0 {
+			return nil, fmt.Errorf("route %s has no soap_endpoint and its WSDL declares no service address", routeHandler.RouteConfig.Key())
+		}
+		faults, err := compileFaultRules(routeHandler.RouteConfig)
+		if err != nil {
+			return nil, err
+		}
+		checks, err := compileParamRules(routeHandler)
+		if err != nil {
+			return nil, err
+		}
+		security, err := newRouteSecurity(routeHandler.RouteConfig)
+		if err != nil {
+			return nil, err
+		}
+		if routeHandler.RouteConfig.Retry != nil && !routeHandler.RouteConfig.Idempotent {
+			return nil, fmt.Errorf("route %s sets retry but is not marked idempotent", routeHandler.RouteConfig.Key())
+		}
+		if coalesceUnsafe(routeHandler.RouteConfig) {
+			return nil, fmt.Errorf("route %s sets coalesce but is neither GET nor marked idempotent", routeHandler.RouteConfig.Key())
+		}
+		client, err := newRouteClient(routeHandler.RouteConfig, logger)
+		if err != nil {
+			return nil, err
+		}
+		endpoints, err := h.newRouteEndpoints(routeHandler.RouteConfig)
+		if err != nil {
+			return nil, err
+		}
+		var probe []byte
+		if lb := routeHandler.RouteConfig.LoadBalancing; lb != nil && lb.HealthCheck != nil {
+			if lb.HealthCheck.Interval <= 0 || lb.HealthCheck.Timeout <= 0 {
+				return nil, fmt.Errorf("route %s: health check interval and timeout must be positive", routeHandler.RouteConfig.Key())
+			}
+			probe, err = os.ReadFile(lb.HealthCheck.Request)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: failed to read health check request: %w", routeHandler.RouteConfig.Key(), err)
+			}
+		}
+		routes = append(routes, &route{
+			handler:   routeHandler,
+			client:    client,
+			endpoints: endpoints,
+			probe:     probe,
+			security:  security,
+			faults:    faults,
+			checks:    checks,
+			retry:     newRetryPolicy(routeHandler.RouteConfig),
+			cache:     newCachePolicy(routeHandler.RouteConfig),
+			coalesce:  routeHandler.RouteConfig.Coalesce,
+		})
+	}
+
+	return newRouter(routes)
 }
 
 // ServeHTTP implements http.Handler
-func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	w := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+	obs := newObservation()
+	defer h.observeRequest(obs, w, start)
+
 	path := r.URL.Path
 
-	routeHandler, ok := (*h.routeHandlerRegistry)[path]
-	if !ok {
-		http.NotFound(w, r)
+	routes := h.router.Load().match(path)
+	if len(routes) == 0 {
+		writeProblem(w, r, newProblem(http.StatusNotFound, "no route matches the request path"))
+		return
+	}
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", routes.allow())
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
+	rt := routes.route(r.Method)
+	if rt == nil {
+		w.Header().Set("Allow", routes.allow())
+		writeProblem(w, r, newProblem(http.StatusMethodNotAllowed, r.Method+" is not allowed on this route"))
+		return
+	}
+	routeHandler := rt.handler
+	params := rt.params(path)
+	obs.route = routeHandler.RouteConfig.Path
+	obs.action = routeHandler.RouteConfig.SoapAction
+
+	if h.metrics != nil {
+		active := h.metrics.ActiveRequests.WithLabelValues(obs.route)
+		active.Inc()
+		defer active.Dec()
+	}
+
 	// Parse request body if present
 	var body map[string]interface{}
 	if r.Body != nil && r.ContentLength > 0 {
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 			h.logger.Error("Failed to parse request body", zap.Error(err))
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeProblem(w, r, newProblem(http.StatusBadRequest, "invalid request body: "+err.Error()))
 			return
 		}
 		defer r.Body.Close()
 	}
 
+	// Validate the body and parameters against the WSDL input schema before templating
+	if routeHandler.RouteConfig.ValidateRequest && routeHandler.RequestSchema != nil {
+		fieldErrors := validateParams(rt.checks, params, r.URL.Query(), routeHandler.RequestSchema.Validate(body))
+		if len(fieldErrors) > 0 {
+			h.logger.Info("Request failed schema validation",
+				zap.String("path", path),
+				zap.Any("errors", fieldErrors),
+			)
+			p := newProblem(http.StatusBadRequest, "request does not match the WSDL schema")
+			p.Errors = fieldErrors
+			writeProblem(w, r, p)
+			return
+		}
+	}
+
+	data := templateData(r, params, body)
 	var buf bytes.Buffer
-	if err := routeHandler.RequestTemplate.Execute(&buf, body); err != nil {
-		h.logger.Error("Failed to parse request body", zap.Error(err))
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if err := routeHandler.RequestTemplate.Execute(&buf, data); err != nil {
+		h.logger.Error("Failed to execute request template", zap.Error(err))
+		writeProblem(w, r, newProblem(http.StatusBadRequest, "invalid request: "+err.Error()))
 		return
 	}
 
-	// Process request in worker pool
-	err := h.pool.WithContext(r.Context(), func() error {
-		return h.processRequest(w, r, &routeHandler.RouteConfig, buf, &routeHandler.Parser)
-	})
+	// Cached responses are served without taking a worker
+	var cacheKey string
+	if rt.cache != nil {
+		cacheKey = rt.cache.key(routeHandler.RouteConfig, buf.Bytes(), data)
+		if h.serveCached(w, r, rt, cacheKey, buf.Bytes(), obs) {
+			return
+		}
+	}
+
+	// Process request in worker pool, requests of coalescing routes join an
+	// identical call in flight before taking a worker
+	var err error
+	if rt.coalesce {
+		err = h.processCoalesced(w, r, rt, buf, cacheKey, obs)
+	} else {
+		err = h.pool.WithContext(r.Context(), func() error {
+			return h.processRequest(w, r, rt, buf, cacheKey, obs)
+		})
+	}
+
+	if errors.Is(err, ErrPoolSaturated) || errors.Is(err, ErrQueueTimeout) {
+		h.logger.Warn("Rejecting request, worker pool is busy",
+			zap.String("path", path),
+			zap.Int("active", h.pool.Active()),
+			zap.Int("queued", h.pool.Queued()),
+			zap.Error(err),
+		)
+		retryAfter := int(math.Ceil(h.pool.QueueTimeout().Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		writeProblem(w, r, newProblem(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		// Nobody reads the answer, it is only recorded as a client error
+		h.logger.Info("Client closed the request",
+			zap.String("path", path),
+			zap.Int("active", h.pool.Active()),
+			zap.Int("queued", h.pool.Queued()),
+		)
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+
+	var open *transport.CircuitOpenError
+	if errors.As(err, &open) {
+		h.logger.Warn("Rejecting request, circuit breaker is open",
+			zap.String("path", path),
+			zap.String("endpoint", open.Endpoint),
+		)
+		retryAfter := int(math.Ceil(open.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		writeProblem(w, r, newProblem(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+
+	if errors.Is(err, transport.ErrInvalidSignature) {
+		h.logger.Warn("Rejected SOAP response",
+			zap.String("path", path),
+			zap.Error(err),
+		)
+		writeProblem(w, r, newProblem(http.StatusBadGateway, err.Error()))
+		return
+	}
+
+	var fault *SoapFault
+	if errors.As(err, &fault) {
+		obs.faultCode = fault.Code
+		p := faultProblem(rt.faults, fault)
+		h.logger.Warn("SOAP service returned a fault",
+			zap.String("path", path),
+			zap.String("code", fault.Code),
+			zap.String("fault", fault.String),
+			zap.Int("status", p.Status),
+		)
+		writeProblem(w, r, p)
+		return
+	}
+
+	var upstream *upstreamError
+	if errors.As(err, &upstream) {
+		p := upstream.problem()
+		h.logger.Error("SOAP service call failed",
+			zap.String("path", path),
+			zap.Int("status", p.Status),
+			zap.ByteString("response", upstream.body),
+			zap.Error(err),
+		)
+		writeProblem(w, r, p)
+		return
+	}
 
 	if err != nil {
 		h.logger.Error("Request processing failed", zap.Error(err))
-		// Return error as JSON response
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": err.Error(),
-		})
+		writeProblem(w, r, newProblem(http.StatusInternalServerError, err.Error()))
 		return
 	}
 }
 
-func (h *Handler) processRequest(w http.ResponseWriter, r *http.Request, route *config.RouteConfig, body bytes.Buffer, parser *func([]byte) (string, error)) error {
-	// Log the SOAP request
-	h.logger.Info("Sending SOAP request",
-		zap.String("endpoint", route.SoapEndpoint),
-		zap.String("action", route.Headers["SOAPAction"]),
-		zap.String("request", fmt.Sprintf("%q", body.String())),
-	)
+// loadDynamicRoute completes a route in dynamic mode with the parser and
+// schemas built from its WSDL
+func loadDynamicRoute(routeHandler generated.GeneratedRouteHandler) (generated.GeneratedRouteHandler, error) {
+	operation, err := dynamic.Load(routeHandler.RouteConfig)
+	if err != nil {
+		return routeHandler, err
+	}
+
+	routeHandler.RouteConfig = operation.Route
+	routeHandler.Parser = operation.Parse
+	routeHandler.RequestSchema = operation.RequestSchema
+	routeHandler.ResponseSchema = operation.ResponseSchema
+	return routeHandler, nil
+}
+
+// templateData builds the data passed to request templates. Path parameters,
+// query parameters, headers and the JSON body are exposed as `.path`,
+// `.query`, `.headers` and `.body`. Repeated query parameters become lists.
+func templateData(r *http.Request, params map[string]string, body map[string]interface{}) map[string]interface{} {
+	query := make(map[string]interface{})
+	for key, values := range r.URL.Query() {
+		if len(values) == 1 {
+			query[key] = values[0]
+		} else {
+			query[key] = values
+		}
+	}
+
+	headers := make(map[string]string, len(r.Header))
+	for key := range r.Header {
+		headers[key] = r.Header.Get(key)
+	}
+
+	return map[string]interface{}{
+		"path":    params,
+		"query":   query,
+		"headers": headers,
+		"body":    body,
+	}
+}
+
+// newRouteSecurity builds the WS-Security settings of a route and loads its
+// signing and trusted certificates, nil when the route uses no WS-Security
+func newRouteSecurity(route config.RouteConfig) (*transport.Security, error) {
+	cfg := route.Security
+	if cfg == nil {
+		return nil, nil
+	}
+	security := &transport.Security{
+		Username:       cfg.Username,
+		Password:       cfg.Password,
+		PasswordDigest: cfg.PasswordType == config.PasswordDigest,
+		TimestampTTL:   cfg.TimestampTTL,
+		MustUnderstand: cfg.MustUnderstand,
+	}
 
-	// Create SOAP request
-	req, err := http.NewRequestWithContext(r.Context(), "POST", route.SoapEndpoint, &body)
+	if cfg.SignCert != "" || cfg.SignKey != "" {
+		if cfg.SignCert == "" || cfg.SignKey == "" {
+			return nil, fmt.Errorf("route %s: signing requires both sign_cert and sign_key", route.Key())
+		}
+		signer, err := transport.LoadSigner(cfg.SignCert, cfg.SignKey)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Key(), err)
+		}
+		security.Signer = signer
+	}
+
+	if cfg.VerifyCert != "" {
+		verifier, err := transport.LoadVerifier(cfg.VerifyCert)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", route.Key(), err)
+		}
+		security.Verifier = verifier
+	}
+
+	return security, nil
+}
+
+// newRouteClient builds the SOAP transport client for a route from its
+// settings and loads its TLS certificates. The client is shared by all
+// endpoints of the route.
+func newRouteClient(route config.RouteConfig, logger *zap.Logger) (*transport.Client, error) {
+	tlsConfig, err := newRouteTLS(route.Transport.TLS)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("route %s: %w", route.Key(), err)
+	}
+
+	return transport.NewClientWithOptions(transport.Options{
+		Timeout:               routeTimeout(route),
+		MaxIdleConns:          route.Transport.MaxIdleConns,
+		MaxIdleConnsPerHost:   route.Transport.MaxIdleConnsPerHost,
+		IdleConnTimeout:       route.Transport.IdleConnTimeout,
+		TLSHandshakeTimeout:   route.Transport.TLSHandshakeTimeout,
+		KeepAlive:             route.Transport.KeepAlive,
+		ResponseHeaderTimeout: route.Transport.ResponseHeaderTimeout,
+		TLS:                   tlsConfig,
+	}, logger), nil
+}
+
+// newRouteEndpoints builds the balancer over the endpoints of a route, each
+// endpoint taking its circuit breaker from the handler registry
+func (h *Handler) newRouteEndpoints(route config.RouteConfig) (*transport.Balancer, error) {
+	var endpoints []*transport.Endpoint
+	for _, endpoint := range route.Endpoints() {
+		var breaker *transport.Breaker
+		if cb := route.CircuitBreaker; cb != nil {
+			breaker = h.breakers.Get(endpoint.URL, transport.BreakerOptions{
+				FailureRate:      cb.FailureRate,
+				SlowCallRate:     cb.SlowCallRate,
+				SlowCallDuration: cb.SlowCallDuration,
+				WindowSize:       cb.WindowSize,
+				MinimumCalls:     cb.MinimumCalls,
+				OpenDuration:     cb.OpenDuration,
+				HalfOpenCalls:    cb.HalfOpenCalls,
+			})
+		}
+		endpoints = append(endpoints, transport.NewEndpoint(endpoint.URL, endpoint.Weight, breaker))
+	}
+
+	opts := transport.BalancerOptions{OnHealthChange: h.endpointHealthChanged}
+	if lb := route.LoadBalancing; lb != nil {
+		opts.Strategy = lb.Strategy
+		opts.EjectAfter = lb.EjectAfter
+		opts.EjectDuration = lb.EjectDuration
+	}
+	balancer, err := transport.NewBalancer(endpoints, opts)
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", route.Key(), err)
 	}
+	return balancer, nil
+}
+
+// startEndpoints starts the health checks of the routes of a router and
+// exposes the state of their endpoints
+func (h *Handler) startEndpoints(r *router) {
+	for _, rt := range r.routes() {
+		if lb := rt.handler.RouteConfig.LoadBalancing; lb != nil && lb.HealthCheck != nil {
+			err := rt.endpoints.StartHealthChecks(lb.HealthCheck.Interval, lb.HealthCheck.Timeout, h.probeEndpoint(rt))
+			if err != nil {
+				h.logger.Error("Failed to start health checks",
+					zap.String("route", rt.handler.RouteConfig.Key()),
+					zap.Error(err),
+				)
+			}
+		}
+	}
+	h.observeEndpoints(r)
+}
+
+// probeEndpoint returns the health check of the endpoints of a route, which
+// posts the probe envelope and expects a 200 answer
+func (h *Handler) probeEndpoint(rt *route) transport.ProbeFunc {
+	route := &rt.handler.RouteConfig
+	action := route.LoadBalancing.HealthCheck.SoapAction
+	return func(ctx context.Context, endpoint *transport.Endpoint) error {
+		payload := rt.probe
+		if rt.security != nil {
+			var err error
+			payload, err = rt.security.Apply(payload, time.Now())
+			if err != nil {
+				return fmt.Errorf("failed to add WS-Security header: %w", err)
+			}
+		}
 
-	// Set headers
-	req.Header.Set("Content-Type", "text/xml;charset=UTF-8")
+		req, err := newSOAPRequest(ctx, route, endpoint.URL(), action, payload)
+		if err != nil {
+			return err
+		}
+		resp, err := rt.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// newRouteTLS builds the TLS configuration of a route, nil when the route
+// keeps the Go defaults
+func newRouteTLS(cfg *config.TLSConfig) (*transport.TLSConfig, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	return transport.NewTLSConfig(transport.TLSOptions{
+		CAFile:       cfg.CAFile,
+		CertFile:     cfg.CertFile,
+		KeyFile:      cfg.KeyFile,
+		ServerName:   cfg.ServerName,
+		MinVersion:   cfg.MinVersion,
+		CipherSuites: cfg.CipherSuites,
+	})
+}
+
+// soapAction returns the SOAP action URI of a route. A SOAPAction header set in
+// the route headers wins over the soapAction read from the WSDL binding.
+func soapAction(route config.RouteConfig) string {
 	for k, v := range route.Headers {
-		req.Header.Set(k, v)
+		if strings.EqualFold(k, "SOAPAction") {
+			return strings.Trim(v, `"`)
+		}
 	}
+	return route.SoapActionURI
+}
 
-	// Log headers
-	h.logger.Info("Request headers",
-		zap.Any("headers", req.Header),
-	)
+// routeTimeout returns the upstream timeout of a route
+func routeTimeout(route config.RouteConfig) time.Duration {
+	if route.Timeout > 0 {
+		return route.Timeout
+	}
+	return defaultRouteTimeout
+}
 
-	// Send request
-	resp, err := h.client.Do(req)
+// processRequest calls the SOAP backend of a route and writes the REST
+// response. The response is stored under cacheKey when it is set.
+func (h *Handler) processRequest(w http.ResponseWriter, r *http.Request, rt *route, body bytes.Buffer, cacheKey string, obs *observation) error {
+	response, entry, err := h.upstreamCall(rt, body, cacheKey)(r.Context(), obs)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	return writeResponse(w, r, rt, response, entry, cacheMiss)
+}
 
-	// Read response
-	respBody, err := io.ReadAll(resp.Body)
+// processCoalesced is processRequest for coalescing routes: a request shares
+// the call of an identical request in flight. Only the shared call takes a
+// worker, the requests waiting for it do not.
+func (h *Handler) processCoalesced(w http.ResponseWriter, r *http.Request, rt *route, body bytes.Buffer, cacheKey string, obs *observation) error {
+	call := h.upstreamCall(rt, body, cacheKey)
+	key := rt.handler.RouteConfig.Key() + "\x00" + body.String()
+	response, entry, shared, err := h.flights.do(r.Context(), key, obs, func(ctx context.Context, obs *observation) ([]byte, *cache.Entry, error) {
+		var (
+			response []byte
+			entry    *cache.Entry
+		)
+		err := h.pool.WithContext(ctx, func() error {
+			var err error
+			response, entry, err = call(ctx, obs)
+			return err
+		})
+		return response, entry, err
+	})
+
+	result := cacheMiss
+	if shared {
+		h.observeCoalesced(obs)
+		result = cacheCoalesced
+	}
 	if err != nil {
 		return err
 	}
+	return writeResponse(w, r, rt, response, entry, result)
+}
+
+// upstreamCall returns the call of a request to the SOAP backend of a route,
+// which renders the REST response and stores it under cacheKey when it is set
+func (h *Handler) upstreamCall(rt *route, body bytes.Buffer, cacheKey string) callFunc {
+	route := &rt.handler.RouteConfig
+	return func(ctx context.Context, obs *observation) ([]byte, *cache.Entry, error) {
+		// Log the SOAP request
+		h.logger.Info("Sending SOAP request",
+			zap.String("action", soapAction(*route)),
+			zap.String("request", fmt.Sprintf("%q", body.String())),
+		)
+
+		respBody, err := h.fetch(ctx, rt, body.Bytes(), obs)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		response, err := renderSOAPResponse(rt.handler, respBody)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var entry *cache.Entry
+		if cacheKey != "" {
+			entry = h.storeCached(ctx, rt, cacheKey, respBody)
+		}
+		return response, entry, nil
+	}
+}
+
+// fetch calls the SOAP backend of a route, retrying as its policy allows, and
+// returns the body of a successful response. Faults and error statuses are
+// returned as errors.
+func (h *Handler) fetch(ctx context.Context, rt *route, envelope []byte, obs *observation) ([]byte, error) {
+	route := &rt.handler.RouteConfig
+
+	// Bound the upstream calls, retries included, by the route timeout
+	ctx, cancel := context.WithTimeout(ctx, routeTimeout(*route))
+	defer cancel()
+
+	var (
+		status   int
+		respBody []byte
+		err      error
+	)
+	for attempt := 1; ; attempt++ {
+		status, respBody, err = h.roundTrip(ctx, rt, envelope, obs)
+		reason := rt.retry.reason(status, respBody, err)
+		if reason == "" || attempt >= rt.retry.MaxAttempts || !rt.retry.wait(ctx, attempt) {
+			break
+		}
+
+		h.logger.Warn("Retrying SOAP request",
+			zap.String("action", soapAction(*route)),
+			zap.Int("attempt", attempt+1),
+			zap.String("reason", reason),
+			zap.Int("status", status),
+			zap.Error(err),
+		)
+		if h.metrics != nil {
+			h.metrics.UpstreamRetries.WithLabelValues(obs.route, obs.action, retryLabel(reason, status)).Inc()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	// Check for non-200 status codes
-	if resp.StatusCode != http.StatusOK {
-		return processResponseError(respBody, resp.StatusCode)
+	if status != http.StatusOK {
+		return nil, processResponseError(respBody, status)
 	}
+	return respBody, nil
+}
 
-	// Parse SOAP response using the appropriate parser
-	response, err := (*parser)(respBody)
+// renderSOAPResponse parses a SOAP response with the parser of a route and
+// renders the JSON body of the REST response
+func renderSOAPResponse(routeHandler generated.GeneratedRouteHandler, respBody []byte) ([]byte, error) {
+	parsed, err := routeHandler.Parser(respBody)
 	if err != nil {
-		return fmt.Errorf("failed to parse SOAP response: %w", err)
+		return nil, &upstreamError{body: respBody, err: fmt.Errorf("failed to parse SOAP response: %w", err)}
 	}
+	return renderResponse(routeHandler, parsed)
+}
 
-	// Write the JSON response
+// writeResponse writes the JSON response. Responses of cached routes carry
+// their ETag, age and freshness. A response served from the cache is answered
+// with 304 when If-None-Match matches its ETag, one just fetched is always sent.
+func writeResponse(w http.ResponseWriter, r *http.Request, rt *route, response []byte, entry *cache.Entry, result string) error {
 	w.Header().Set("Content-Type", "application/json")
-	_, err = w.Write([]byte(response))
+
+	if entry != nil {
+		now := time.Now()
+		sum := sha256.Sum256(response)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", rt.cache.cacheControl(entry, now))
+		w.Header().Set("X-Cache", strings.ToUpper(result))
+		w.Header().Set("Age", strconv.Itoa(int(now.Sub(entry.Stored).Seconds())))
+		if (result == cacheHit || result == cacheStale) && etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+
+	_, err := w.Write(response)
 	return err
 }
 
-func processResponseError(respBody []byte, statusCode int) error {
-	var soapFault struct {
-		XMLName xml.Name `xml:"Envelope"`
-		Body    struct {
-			Fault *struct {
-				FaultCode   string `xml:"faultcode"`
-				FaultString string `xml:"faultstring"`
-			} `xml:"Fault"`
-		} `xml:"Body"`
+// roundTrip makes one call to the SOAP backend and returns the status and body
+// of its response. Every call gets a fresh WS-Security header.
+func (h *Handler) roundTrip(ctx context.Context, rt *route, envelope []byte, obs *observation) (int, []byte, error) {
+	route := &rt.handler.RouteConfig
+
+	// The WS-Security header is added after the request was logged so
+	// passwords stay out of the logs
+	payload := envelope
+	if rt.security != nil {
+		var err error
+		payload, err = rt.security.Apply(payload, time.Now())
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to add WS-Security header: %w", err)
+		}
+	}
+
+	// Create SOAP request for the next endpoint
+	endpoint := rt.endpoints.Next()
+	req, err := newSOAPRequest(ctx, route, endpoint.URL(), soapAction(*route), payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Log headers
+	h.logger.Info("Request headers",
+		zap.String("endpoint", endpoint.URL()),
+		zap.Any("headers", req.Header),
+	)
+
+	// Send request
+	upstreamStart := time.Now()
+	resp, err := rt.client.DoEndpoint(req, endpoint)
+	if errors.Is(err, transport.ErrCircuitOpen) {
+		// The backend was not called
+		obs.upstreamStatus = "circuit_open"
+		return 0, nil, err
 	}
+	if err != nil {
+		h.observeUpstream(obs, "error", upstreamStart)
+		return 0, nil, &upstreamError{err: err}
+	}
+	defer resp.Body.Close()
+	h.observeUpstream(obs, strconv.Itoa(resp.StatusCode), upstreamStart)
 
-	if err := xml.Unmarshal(respBody, &soapFault); err == nil && soapFault.Body.Fault != nil {
-		return &SoapFault{
-			Code:   soapFault.Body.Fault.FaultCode,
-			String: soapFault.Body.Fault.FaultString,
+	// Read response
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, &upstreamError{err: err}
+	}
+
+	// Reject responses whose signature does not verify, faults included, and
+	// keep only the verified Body
+	if rt.security != nil && rt.security.Verifier != nil {
+		respBody, err = rt.security.Verifier.Verify(respBody)
+		if err != nil {
+			return 0, nil, err
 		}
 	}
 
-	// If not a SOAP fault, return a generic error with the response body
-	return fmt.Errorf("SOAP service returned error (status %d): %s", statusCode, string(respBody))
+	return resp.StatusCode, respBody, nil
 }
 
-// SoapFault represents a SOAP fault response
-type SoapFault struct {
-	Code   string
-	String string
+// newSOAPRequest creates the request posting an envelope to an endpoint of a
+// route with the route headers and the SOAP action of the route version
+func newSOAPRequest(ctx context.Context, route *config.RouteConfig, endpoint, action string, payload []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	// The SOAPAction of the route headers is already part of action
+	for k, v := range route.Headers {
+		if !strings.EqualFold(k, "SOAPAction") {
+			req.Header.Set(k, v)
+		}
+	}
+
+	// SOAP 1.2 moves the action into the Content-Type and has no SOAPAction header
+	version := route.EnvelopeVersion()
+	if version == config.SoapVersion12 {
+		req.Header.Set("Content-Type", soapenv.ContentType(version, action))
+	} else {
+		req.Header.Set("Content-Type", soapenv.ContentType(version, ""))
+		req.Header.Set("SOAPAction", strconv.Quote(action))
+	}
+	return req, nil
 }
 
-func (f *SoapFault) Error() string {
-	return f.String
+// renderResponse turns the parsed SOAP response into the JSON body of the REST response
+func renderResponse(routeHandler generated.GeneratedRouteHandler, parsed interface{}) ([]byte, error) {
+	route := routeHandler.RouteConfig
+	if route.ResponseMode == config.ResponseModeAuto {
+		// Dynamic routes carry the response model that orders the generic values
+		var response []byte
+		var err error
+		if routeHandler.ResponseSchema != nil {
+			response, err = templating.MarshalAutoSchema(parsed, routeHandler.ResponseSchema, route.FieldNaming)
+		} else {
+			response, err = templating.MarshalAuto(parsed, route.FieldNaming)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal SOAP response: %w", err)
+		}
+		return response, nil
+	}
+
+	var buf bytes.Buffer
+	if err := routeHandler.ResponseTemplate.Execute(&buf, parsed); err != nil {
+		return nil, fmt.Errorf("failed to execute response template: %w", err)
+	}
+	return buf.Bytes(), nil
 }
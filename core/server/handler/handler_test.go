@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"rest-to-soap/core/config"
+)
+
+const flagResponse = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+	`<m:CountryFlagResponse xmlns:m="http://www.oorsprong.org/websamples.countryinfo">` +
+	`<m:CountryFlagResult>flag.jpg</m:CountryFlagResult>` +
+	`</m:CountryFlagResponse></soap:Body></soap:Envelope>`
+
+const flagPath = "/api/countries/NL/flag"
+
+// upstream is a SOAP backend answering the CountryFlag operation and
+// counting its calls. While gate is set, calls wait for it to be closed or
+// for the request to be cancelled.
+type upstream struct {
+	*httptest.Server
+	calls atomic.Int32
+	gate  chan struct{}
+}
+
+func newUpstream(t *testing.T) *upstream {
+	t.Helper()
+	u := &upstream{}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u.calls.Add(1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		if u.gate != nil {
+			select {
+			case <-u.gate:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = io.WriteString(w, flagResponse)
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+// newTestHandler builds a handler with a single dynamic route calling the
+// CountryFlag operation of the sample WSDL on endpoint. The server and route
+// settings are merged into the configuration, which is loaded like a file.
+func newTestHandler(t *testing.T, endpoint string, server, route map[string]interface{}) *Handler {
+	t.Helper()
+	h, err := loadTestHandler(t, endpoint, server, route)
+	if err != nil {
+		t.Fatalf("NewHandler() error = %v", err)
+	}
+	return h
+}
+
+func loadTestHandler(t *testing.T, endpoint string, server, route map[string]interface{}) (*Handler, error) {
+	t.Helper()
+	root, err := filepath.Abs("../../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := map[string]interface{}{
+		"path":              "/api/countries/{iso}/flag",
+		"method":            "GET",
+		"mode":              "dynamic",
+		"soap_endpoint":     endpoint,
+		"soap_action":       "CountryFlag",
+		"wsdl_url":          filepath.Join(root, "config/wsdl/wsdl.xml"),
+		"request_template":  filepath.Join(root, "config/templates/request.tmpl"),
+		"response_template": filepath.Join(root, "config/templates/response.tmpl"),
+		"timeout":           "5s",
+	}
+	for k, v := range route {
+		base[k] = v
+	}
+	if server == nil {
+		server = map[string]interface{}{}
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"server": server,
+		"routes": []interface{}{base},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	return NewHandler(cfg, zap.NewNop(), nil)
+}
+
+// serve sends a request to the handler and returns the recorded response
+func serve(h *Handler, method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	transport "rest-to-soap/core/server/soap"
+
+	"go.uber.org/zap"
+)
+
+// unmatchedRoute is the route label used for requests that match no route
+const unmatchedRoute = "unmatched"
+
+// statusRecorder captures the status code written to the client
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// observation collects what happened upstream while a request was handled
+type observation struct {
+	route          string
+	action         string
+	upstreamStatus string
+	faultCode      string
+}
+
+func newObservation() *observation {
+	return &observation{
+		route:          unmatchedRoute,
+		upstreamStatus: "none",
+	}
+}
+
+// observeUpstream records the latency and status of a call to the SOAP backend
+func (h *Handler) observeUpstream(obs *observation, status string, start time.Time) {
+	obs.upstreamStatus = status
+	if h.metrics == nil {
+		return
+	}
+	h.metrics.UpstreamDuration.WithLabelValues(obs.route, obs.action, status).Observe(time.Since(start).Seconds())
+}
+
+// observeCache records whether a request was answered from the response cache
+func (h *Handler) observeCache(obs *observation, result string) {
+	if h.metrics == nil {
+		return
+	}
+	h.metrics.CacheRequests.WithLabelValues(obs.route, obs.action, result).Inc()
+}
+
+// observeCoalesced records a request answered by the upstream call of an
+// identical request
+func (h *Handler) observeCoalesced(obs *observation) {
+	if h.metrics == nil {
+		return
+	}
+	h.metrics.Coalesced.WithLabelValues(obs.route, obs.action).Inc()
+}
+
+// observeRequest records the outcome of a REST request once it has been answered
+func (h *Handler) observeRequest(obs *observation, rec *statusRecorder, start time.Time) {
+	if h.metrics == nil {
+		return
+	}
+
+	status := strconv.Itoa(rec.status)
+	h.metrics.RequestDuration.WithLabelValues(obs.route, obs.action, status).Observe(time.Since(start).Seconds())
+	h.metrics.RequestsTotal.WithLabelValues(obs.route, obs.action, status, obs.upstreamStatus, obs.faultCode).Inc()
+	if rec.status >= http.StatusBadRequest {
+		h.metrics.RequestErrors.WithLabelValues(obs.route, obs.action, status, obs.upstreamStatus, obs.faultCode).Inc()
+	}
+}
+
+// breakerChanged logs and records the state changes of circuit breakers
+func (h *Handler) breakerChanged(endpoint string, from, to transport.BreakerState) {
+	log := h.logger.Info
+	if to == transport.BreakerOpen {
+		log = h.logger.Warn
+	}
+	log("Circuit breaker changed state",
+		zap.String("endpoint", endpoint),
+		zap.Stringer("from", from),
+		zap.Stringer("to", to),
+	)
+
+	if h.metrics == nil {
+		return
+	}
+	label := endpointLabel(endpoint)
+	h.metrics.BreakerState.WithLabelValues(label).Set(float64(to))
+	h.metrics.BreakerChanges.WithLabelValues(label, to.String()).Inc()
+}
+
+// endpointHealthChanged logs and records endpoints leaving or returning to
+// the rotation of their route
+func (h *Handler) endpointHealthChanged(endpoint string, healthy bool, reason string) {
+	log, value := h.logger.Warn, 0.0
+	if healthy {
+		log, value = h.logger.Info, 1.0
+	}
+	log("SOAP endpoint health changed",
+		zap.String("endpoint", endpoint),
+		zap.Bool("healthy", healthy),
+		zap.String("reason", reason),
+	)
+
+	if h.metrics != nil {
+		h.metrics.EndpointHealthy.WithLabelValues(endpointLabel(endpoint)).Set(value)
+	}
+}
+
+// observeEndpoints exposes the current state of the endpoints and breakers
+// used by a router
+func (h *Handler) observeEndpoints(r *router) {
+	if h.metrics == nil {
+		return
+	}
+	for _, rt := range r.routes() {
+		for _, endpoint := range rt.endpoints.Endpoints() {
+			label := endpointLabel(endpoint.URL())
+			h.metrics.EndpointHealthy.WithLabelValues(label).Set(1)
+			if breaker := endpoint.Breaker(); breaker != nil {
+				h.metrics.BreakerState.WithLabelValues(label).Set(float64(breaker.State()))
+			}
+		}
+	}
+}
+
+// endpointLabel returns an endpoint without its credentials, query and
+// fragment, for use as a metric label
+func endpointLabel(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "invalid"
+	}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	return u.String()
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"rest-to-soap/core/schema"
+	generated "rest-to-soap/pkg/generated"
+)
+
+// paramRule checks a path or query parameter against an element of the
+// request schema
+type paramRule struct {
+	// source is "path" or "query"
+	source string
+	name   string
+	// field is the dotted path of the element, which the body need not set
+	field   string
+	element *schema.Element
+}
+
+// compileParamRules resolves the validate_params of a route against its
+// request schema, nil unless the route validates requests
+func compileParamRules(routeHandler generated.GeneratedRouteHandler) ([]paramRule, error) {
+	route := routeHandler.RouteConfig
+	if !route.ValidateRequest || len(route.ValidateParams) == 0 {
+		return nil, nil
+	}
+	if routeHandler.RequestSchema == nil {
+		return nil, fmt.Errorf("route %s: validate_params needs the request schema of its WSDL operation", route.Key())
+	}
+
+	refs, err := route.ParamRefs()
+	if err != nil {
+		return nil, fmt.Errorf("route %s: %w", route.Key(), err)
+	}
+	rules := make([]paramRule, 0, len(refs))
+	for _, ref := range refs {
+		element, err := routeHandler.RequestSchema.Lookup(ref.Element)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: validate_params.%s: %w", route.Key(), ref.Key, err)
+		}
+		rules = append(rules, paramRule{source: ref.Source, name: ref.Name, field: ref.Element, element: element})
+	}
+	return rules, nil
+}
+
+// validateParams checks the path and query parameters of a request against
+// the rules of its route. Body errors on the elements the parameters fill in
+// are dropped.
+func validateParams(rules []paramRule, params map[string]string, query url.Values, bodyErrs []schema.FieldError) []schema.FieldError {
+	var errs []schema.FieldError
+	for _, err := range bodyErrs {
+		if !coversField(rules, err.Field) {
+			errs = append(errs, err)
+		}
+	}
+	for _, rule := range rules {
+		values := query[rule.name]
+		if rule.source == "path" {
+			values = []string{params[rule.name]}
+		}
+		errs = append(errs, rule.element.ValidateValues(rule.source+"."+rule.name, values)...)
+	}
+	return errs
+}
+
+// coversField reports whether a parameter fills in the element of a body field
+func coversField(rules []paramRule, field string) bool {
+	for _, rule := range rules {
+		if field == rule.field || strings.HasPrefix(field, rule.field+"[") {
+			return true
+		}
+	}
+	return false
+}
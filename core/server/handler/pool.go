@@ -2,44 +2,139 @@ package handler
 
 import (
 	"context"
-	"sync"
+	"errors"
+	"sync/atomic"
+	"time"
 )
 
-// Pool manages a pool of workers for processing requests
+const (
+	defaultWorkers      = 10
+	defaultQueueSize    = 100
+	defaultQueueTimeout = 5 * time.Second
+)
+
+var (
+	// ErrPoolSaturated is returned when all workers are busy and the wait queue is full
+	ErrPoolSaturated = errors.New("worker pool saturated")
+	// ErrQueueTimeout is returned when a request waited too long for a free worker
+	ErrQueueTimeout = errors.New("timed out waiting for a free worker")
+)
+
+// Pool manages a bounded pool of workers for processing requests.
+// At most `workers` functions run at the same time, and at most `queueSize`
+// callers wait for a free worker; everything beyond that is rejected.
 type Pool struct {
-	workers int
-	wg      sync.WaitGroup
+	workers      chan struct{}
+	queue        chan struct{}
+	queueTimeout time.Duration
+	active       int64
+	queued       int64
 }
 
-// NewPool creates a new worker pool
-func NewPool() *Pool {
+// NewPool creates a new worker pool. Zero values fall back to the defaults.
+func NewPool(workers, queueSize int, queueTimeout time.Duration) *Pool {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	if queueTimeout <= 0 {
+		queueTimeout = defaultQueueTimeout
+	}
+
 	return &Pool{
-		workers: 10, // Default number of workers
+		workers:      make(chan struct{}, workers),
+		queue:        make(chan struct{}, queueSize),
+		queueTimeout: queueTimeout,
 	}
 }
 
-// Size returns the current number of workers in the pool
+// Size returns the number of workers in the pool
 func (p *Pool) Size() int {
-	return p.workers
+	return cap(p.workers)
 }
 
-// WithContext executes a function in the worker pool with the given context
+// Active returns the number of workers currently running a function
+func (p *Pool) Active() int {
+	return int(atomic.LoadInt64(&p.active))
+}
+
+// Queued returns the number of callers waiting for a free worker
+func (p *Pool) Queued() int {
+	return int(atomic.LoadInt64(&p.queued))
+}
+
+// QueueTimeout returns how long a caller may wait for a free worker
+func (p *Pool) QueueTimeout() time.Duration {
+	return p.queueTimeout
+}
+
+// WithContext executes a function in the worker pool with the given context.
+// The function runs on the calling goroutine once a worker slot is acquired,
+// so the slot is held for exactly as long as the function runs.
 func (p *Pool) WithContext(ctx context.Context, fn func() error) error {
-	p.wg.Add(1)
-	defer p.wg.Done()
+	if err := p.acquire(ctx); err != nil {
+		return err
+	}
+	atomic.AddInt64(&p.active, 1)
+	defer func() {
+		atomic.AddInt64(&p.active, -1)
+		<-p.workers
+	}()
 
-	// Create a channel to receive the result
-	result := make(chan error, 1)
+	return fn()
+}
 
-	// Execute the function in a goroutine
+// TryGo runs a function in the background when a worker is free and reports
+// whether it did. It never waits in the queue, so background work does not
+// hold back requests.
+func (p *Pool) TryGo(fn func()) bool {
+	select {
+	case p.workers <- struct{}{}:
+	default:
+		return false
+	}
+	atomic.AddInt64(&p.active, 1)
 	go func() {
-		result <- fn()
+		defer func() {
+			atomic.AddInt64(&p.active, -1)
+			<-p.workers
+		}()
+		fn()
 	}()
+	return true
+}
 
-	// Wait for either the context to be done or the function to complete
+// acquire takes a worker slot, waiting in the queue if every worker is busy
+func (p *Pool) acquire(ctx context.Context) error {
+	// Fast path: a worker is free
 	select {
-	case err := <-result:
-		return err
+	case p.workers <- struct{}{}:
+		return nil
+	default:
+	}
+
+	// Reserve a place in the queue or reject immediately
+	select {
+	case p.queue <- struct{}{}:
+	default:
+		return ErrPoolSaturated
+	}
+	atomic.AddInt64(&p.queued, 1)
+	defer func() {
+		atomic.AddInt64(&p.queued, -1)
+		<-p.queue
+	}()
+
+	timer := time.NewTimer(p.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case p.workers <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrQueueTimeout
 	case <-ctx.Done():
 		return ctx.Err()
 	}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fillPool occupies every worker and queue slot of a pool with calls that
+// block until the returned function is called
+func fillPool(t *testing.T, p *Pool, workers, queued int) (release func()) {
+	t.Helper()
+	done := make(chan struct{})
+	for i := 0; i < workers+queued; i++ {
+		go p.WithContext(context.Background(), func() error {
+			<-done
+			return nil
+		})
+	}
+	waitFor(t, func() bool { return p.Active() == workers && p.Queued() == queued })
+	return func() { close(done) }
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPool(t *testing.T) {
+	tests := []struct {
+		name      string
+		workers   int
+		queueSize int
+		// busy and waiting are the calls holding a worker and waiting in
+		// the queue before the call under test
+		busy, waiting int
+		// cancel cancels the context of the call while it waits
+		cancel  bool
+		wantErr error
+	}{
+		{name: "free worker", workers: 2, queueSize: 1, busy: 1},
+		{name: "saturated", workers: 1, queueSize: 1, busy: 1, waiting: 1, wantErr: ErrPoolSaturated},
+		{name: "queue timeout", workers: 1, queueSize: 2, busy: 1, wantErr: ErrQueueTimeout},
+		{name: "cancelled while queued", workers: 1, queueSize: 2, busy: 1, cancel: true, wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(tt.workers, tt.queueSize, 50*time.Millisecond)
+			release := fillPool(t, p, tt.busy, tt.waiting)
+			defer release()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				go func() {
+					waitFor(t, func() bool { return p.Queued() == tt.waiting+1 })
+					cancel()
+				}()
+			}
+
+			ran := false
+			err := p.WithContext(ctx, func() error {
+				ran = true
+				if got := p.Active(); got != tt.busy+1 {
+					t.Errorf("Active() = %d while running, want %d", got, tt.busy+1)
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("WithContext() error = %v, want %v", err, tt.wantErr)
+			}
+			if ran != (tt.wantErr == nil) {
+				t.Fatalf("function ran = %v, want %v", ran, tt.wantErr == nil)
+			}
+			if p.Active() != tt.busy || p.Queued() != tt.waiting {
+				t.Fatalf("Active() = %d, Queued() = %d after the call, want %d and %d", p.Active(), p.Queued(), tt.busy, tt.waiting)
+			}
+		})
+	}
+}
+
+func TestPoolReturnsError(t *testing.T) {
+	p := NewPool(1, 1, time.Second)
+	want := errors.New("backend failed")
+	if err := p.WithContext(context.Background(), func() error { return want }); err != want {
+		t.Fatalf("WithContext() error = %v, want %v", err, want)
+	}
+	if p.Active() != 0 || p.Queued() != 0 {
+		t.Fatalf("Active() = %d, Queued() = %d, want 0", p.Active(), p.Queued())
+	}
+}
+
+func TestPoolTryGo(t *testing.T) {
+	p := NewPool(1, 1, time.Second)
+	release := fillPool(t, p, 1, 0)
+	if p.TryGo(func() { t.Error("ran on a busy pool") }) {
+		t.Fatal("TryGo() = true with every worker busy")
+	}
+	if p.Queued() != 0 {
+		t.Fatalf("Queued() = %d, TryGo must not queue", p.Queued())
+	}
+	release()
+	waitFor(t, func() bool { return p.Active() == 0 })
+
+	ran := make(chan struct{})
+	if !p.TryGo(func() { close(ran) }) {
+		t.Fatal("TryGo() = false with a free worker")
+	}
+	<-ran
+	waitFor(t, func() bool { return p.Active() == 0 })
+}
+
+func TestServeHTTPPoolBusy(t *testing.T) {
+	backend := newUpstream(t)
+	h := newTestHandler(t, backend.URL, map[string]interface{}{"workers": 1, "queue_size": 1, "queue_timeout": "2s"}, nil)
+
+	release := fillPool(t, h.pool, 1, 1)
+	defer release()
+
+	w := serve(h, http.MethodGet, flagPath, nil)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("Retry-After = %q, want the queue timeout of 2", got)
+	}
+	if backend.calls.Load() != 0 {
+		t.Fatalf("backend called %d times, want 0", backend.calls.Load())
+	}
+}
+
+func TestServeHTTPCancelledWhileQueued(t *testing.T) {
+	backend := newUpstream(t)
+	h := newTestHandler(t, backend.URL, map[string]interface{}{"workers": 1, "queue_size": 1}, nil)
+
+	release := fillPool(t, h.pool, 1, 0)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		waitFor(t, func() bool { return h.pool.Queued() == 1 })
+		cancel()
+	}()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, flagPath, nil).WithContext(ctx))
+	if w.Code != statusClientClosedRequest {
+		t.Fatalf("status = %d, want %d", w.Code, statusClientClosedRequest)
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"rest-to-soap/core/schema"
+)
+
+// problemContentType is the media type of RFC 7807 error responses
+const problemContentType = "application/problem+json"
+
+// statusClientClosedRequest is the nginx status recorded for requests whose
+// client went away before they were answered
+const statusClientClosedRequest = 499
+
+// problem is an RFC 7807 problem details body. Fault and Errors are extension
+// members carrying the SOAP fault and the request validation errors.
+type problem struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"`
+	Fault    *faultInfo          `json:"fault,omitempty"`
+	Errors   []schema.FieldError `json:"errors,omitempty"`
+}
+
+// faultInfo is the SOAP fault exposed in a problem response
+type faultInfo struct {
+	Code     string      `json:"code"`
+	Subcodes []string    `json:"subcodes,omitempty"`
+	String   string      `json:"string"`
+	Actor    string      `json:"actor,omitempty"`
+	Detail   interface{} `json:"detail,omitempty"`
+}
+
+func newProblem(status int, detail string) *problem {
+	return &problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// writeProblem writes a problem response for the request
+func writeProblem(w http.ResponseWriter, r *http.Request, p *problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
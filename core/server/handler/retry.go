@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"rest-to-soap/core/config"
+)
+
+// Retry reasons reported in logs and metrics
+const (
+	retryConnection = "connection"
+	retryStatus     = "status"
+	retryFault      = "fault"
+)
+
+// retryPolicy is the compiled retry configuration of an idempotent route
+type retryPolicy struct {
+	config.RetryConfig
+	statuses map[int]bool
+}
+
+// newRetryPolicy compiles the retry settings of a route, nil when calls of
+// the route must not be retried
+func newRetryPolicy(route config.RouteConfig) *retryPolicy {
+	if !route.Idempotent || route.Retry == nil || route.Retry.MaxAttempts < 2 {
+		return nil
+	}
+	policy := &retryPolicy{
+		RetryConfig: *route.Retry,
+		statuses:    make(map[int]bool, len(route.Retry.Statuses)),
+	}
+	for _, status := range route.Retry.Statuses {
+		policy.statuses[status] = true
+	}
+	return policy
+}
+
+// reason returns why an upstream call should be retried, an empty string when
+// its outcome is final
+func (p *retryPolicy) reason(status int, respBody []byte, err error) string {
+	if p == nil {
+		return ""
+	}
+	if err != nil {
+		if p.ConnectionErrors && connectionError(err) {
+			return retryConnection
+		}
+		return ""
+	}
+	if status == http.StatusOK {
+		return ""
+	}
+	if p.statuses[status] {
+		return retryStatus
+	}
+	if len(p.FaultCodes) > 0 {
+		if fault := parseFault(respBody); fault != nil {
+			for _, code := range p.FaultCodes {
+				if fault.hasCode(code) {
+					return retryFault
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// delay returns the backoff before a retry, retry 1 being the first
+func (p *retryPolicy) delay(retry int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d - time.Duration(rand.Float64()*p.Jitter*float64(d))
+}
+
+// wait sleeps for the backoff before a retry. It returns false without
+// waiting when the retry could not complete before the deadline of ctx.
+func (p *retryPolicy) wait(ctx context.Context, retry int) bool {
+	d := p.delay(retry)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= d {
+		return false
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// connectionError reports whether a call failed because the backend refused,
+// reset or closed the connection. Timeouts and cancellations are not retried.
+func connectionError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryLabel returns the metric label of a retry reason
+func retryLabel(reason string, status int) string {
+	if reason == retryStatus {
+		return strconv.Itoa(status)
+	}
+	return reason
+}
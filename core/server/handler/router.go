@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	transport "rest-to-soap/core/server/soap"
+	generated "rest-to-soap/pkg/generated"
+)
+
+// route is a compiled route from the registry together with its SOAP client
+type route struct {
+	handler   generated.GeneratedRouteHandler
+	client    *transport.Client
+	endpoints *transport.Balancer
+	// probe is the SOAP envelope of the endpoint health checks
+	probe    []byte
+	security *transport.Security
+	faults   []faultRule
+	checks   []paramRule
+	retry    *retryPolicy
+	cache    *cachePolicy
+	// coalesce shares one upstream call between concurrent requests
+	// rendering the same SOAP envelope
+	coalesce bool
+	segments []segment
+}
+
+// segment is one part of a route path, either a literal or a `{name}` parameter
+type segment struct {
+	value string
+	param bool
+}
+
+// pathRoutes groups the routes sharing the same path shape, keyed by HTTP method
+type pathRoutes struct {
+	segments []segment
+	methods  map[string]*route
+}
+
+// matches is the list of path shapes matching a request path, most specific first
+type matches []*pathRoutes
+
+// route returns the route of the most specific shape registered for the
+// method, nil when none is
+func (m matches) route(method string) *route {
+	for _, p := range m {
+		if rt, ok := p.methods[method]; ok {
+			return rt
+		}
+	}
+	return nil
+}
+
+// allow returns the value of the Allow header for the path: the methods of
+// every matching shape
+func (m matches) allow() string {
+	seen := map[string]bool{http.MethodOptions: true}
+	methods := []string{http.MethodOptions}
+	for _, p := range m {
+		for method := range p.methods {
+			if !seen[method] {
+				seen[method] = true
+				methods = append(methods, method)
+			}
+		}
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// router matches request paths against route patterns such as `/api/countries/{iso}/flag`
+type router struct {
+	paths []*pathRoutes
+}
+
+// routes returns every route of the router
+func (r *router) routes() []*route {
+	var routes []*route
+	for _, p := range r.paths {
+		for _, rt := range p.methods {
+			routes = append(routes, rt)
+		}
+	}
+	return routes
+}
+
+// newRouter compiles the routes and orders them so that literal segments win over parameters
+func newRouter(routes []*route) (*router, error) {
+	byShape := make(map[string]*pathRoutes)
+	var paths []*pathRoutes
+	for _, rt := range routes {
+		cfg := rt.handler.RouteConfig
+		segments, err := compilePath(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		rt.segments = segments
+
+		shape := pathShape(segments)
+		group, ok := byShape[shape]
+		if !ok {
+			group = &pathRoutes{segments: segments, methods: make(map[string]*route)}
+			byShape[shape] = group
+			paths = append(paths, group)
+		}
+
+		method := cfg.HTTPMethod()
+		if _, exists := group.methods[method]; exists {
+			return nil, fmt.Errorf("duplicate route %s %s", method, cfg.Path)
+		}
+		group.methods[method] = rt
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		return moreSpecific(paths[i].segments, paths[j].segments)
+	})
+
+	return &router{paths: paths}, nil
+}
+
+// match returns the path shapes matching a request path, most specific
+// first, nil if none match. A less specific shape still serves the methods
+// the more specific ones lack.
+func (rt *router) match(path string) matches {
+	parts := splitPath(path)
+	var m matches
+	for _, candidate := range rt.paths {
+		if _, ok := matchSegments(candidate.segments, parts); ok {
+			m = append(m, candidate)
+		}
+	}
+	return m
+}
+
+// params extracts the path parameters of a request path matched by the route
+func (r *route) params(path string) map[string]string {
+	params, _ := matchSegments(r.segments, splitPath(path))
+	return params
+}
+
+// compilePath splits a route path into literal and parameter segments
+func compilePath(path string) ([]segment, error) {
+	parts := splitPath(path)
+	segments := make([]segment, 0, len(parts))
+	seen := make(map[string]bool)
+	for _, part := range parts {
+		if !strings.HasPrefix(part, "{") && !strings.HasSuffix(part, "}") {
+			segments = append(segments, segment{value: part})
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "}")
+		if len(part) < 2 || part[0] != '{' || part[len(part)-1] != '}' || name == "" || strings.ContainsAny(name, "{}") {
+			return nil, fmt.Errorf("invalid path parameter %q in route %s", part, path)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate path parameter %q in route %s", name, path)
+		}
+		seen[name] = true
+		segments = append(segments, segment{value: name, param: true})
+	}
+	return segments, nil
+}
+
+// pathShape identifies paths that match the same requests regardless of parameter names
+func pathShape(segments []segment) string {
+	parts := make([]string, len(segments))
+	for i, seg := range segments {
+		if seg.param {
+			parts[i] = "{}"
+		} else {
+			parts[i] = seg.value
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// matchSegments matches the parts of a request path against compiled segments
+func matchSegments(segments []segment, parts []string) (map[string]string, bool) {
+	if len(segments) != len(parts) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, seg := range segments {
+		if seg.param {
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg.value] = parts[i]
+			continue
+		}
+		if seg.value != parts[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// moreSpecific reports whether a should be tried before b: the first
+// literal segment where the other has a parameter decides
+func moreSpecific(a, b []segment) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].param != b[i].param {
+			return !a[i].param
+		}
+	}
+	return len(a) > len(b)
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
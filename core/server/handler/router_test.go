@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"rest-to-soap/core/config"
+	generated "rest-to-soap/pkg/generated"
+)
+
+// testRouter builds a router over routes given as "METHOD /path"
+func testRouter(t *testing.T, patterns ...[2]string) *router {
+	t.Helper()
+	routes := make([]*route, 0, len(patterns))
+	for _, p := range patterns {
+		routes = append(routes, &route{handler: generated.GeneratedRouteHandler{
+			RouteConfig: config.RouteConfig{Method: p[0], Path: p[1]},
+		}})
+	}
+	r, err := newRouter(routes)
+	if err != nil {
+		t.Fatalf("newRouter() error = %v", err)
+	}
+	return r
+}
+
+func TestRouterMatch(t *testing.T) {
+	r := testRouter(t,
+		[2]string{"GET", "/countries/{iso}/flag"},
+		[2]string{"GET", "/countries/{iso}/{field}"},
+		[2]string{"GET", "/countries/all/flag"},
+		[2]string{"POST", "/countries/{iso}"},
+		[2]string{"DELETE", "/countries/{code}"},
+		[2]string{"PUT", "/a/{id}"},
+		[2]string{"GET", "/a/b"},
+	)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantPath   string
+		wantParams map[string]string
+		wantAllow  string
+	}{
+		{
+			name: "path parameter", method: "GET", path: "/countries/NL/flag",
+			wantPath: "/countries/{iso}/flag", wantParams: map[string]string{"iso": "NL"},
+			wantAllow: "GET, OPTIONS",
+		},
+		{
+			name: "static over parameter", method: "GET", path: "/countries/all/flag",
+			wantPath: "/countries/all/flag", wantParams: map[string]string{},
+			wantAllow: "GET, OPTIONS",
+		},
+		{
+			name: "several parameters", method: "GET", path: "/countries/NL/name",
+			wantPath: "/countries/{iso}/{field}", wantParams: map[string]string{"iso": "NL", "field": "name"},
+			wantAllow: "GET, OPTIONS",
+		},
+		{
+			name: "trailing slash", method: "GET", path: "/countries/NL/flag/",
+			wantPath: "/countries/{iso}/flag", wantParams: map[string]string{"iso": "NL"},
+			wantAllow: "GET, OPTIONS",
+		},
+		{
+			name: "methods of one shape", method: "DELETE", path: "/countries/NL",
+			wantPath: "/countries/{code}", wantParams: map[string]string{"code": "NL"},
+			wantAllow: "DELETE, OPTIONS, POST",
+		},
+		{
+			name: "less specific shape serves the missing method", method: "PUT", path: "/a/b",
+			wantPath: "/a/{id}", wantParams: map[string]string{"id": "b"},
+			wantAllow: "GET, OPTIONS, PUT",
+		},
+		{
+			name: "method not allowed", method: "PATCH", path: "/a/b",
+			wantAllow: "GET, OPTIONS, PUT",
+		},
+		{name: "no match", method: "GET", path: "/countries"},
+		{name: "empty parameter", method: "GET", path: "/countries//flag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := r.match(tt.path)
+			if tt.wantAllow == "" {
+				if len(m) != 0 {
+					t.Fatalf("match(%q) = %d shapes, want none", tt.path, len(m))
+				}
+				return
+			}
+			if got := m.allow(); got != tt.wantAllow {
+				t.Errorf("allow() = %q, want %q", got, tt.wantAllow)
+			}
+
+			rt := m.route(tt.method)
+			if tt.wantPath == "" {
+				if rt != nil {
+					t.Fatalf("route(%s) = %s, want none", tt.method, rt.handler.RouteConfig.Path)
+				}
+				return
+			}
+			if rt == nil {
+				t.Fatalf("route(%s) = nil, want %s", tt.method, tt.wantPath)
+			}
+			if rt.handler.RouteConfig.Path != tt.wantPath {
+				t.Fatalf("route(%s) = %s, want %s", tt.method, rt.handler.RouteConfig.Path, tt.wantPath)
+			}
+			if params := rt.params(tt.path); !reflect.DeepEqual(params, tt.wantParams) {
+				t.Fatalf("params() = %v, want %v", params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestNewRouterErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns [][2]string
+	}{
+		{"duplicate route", [][2]string{{"GET", "/a/{id}"}, {"GET", "/a/{name}"}}},
+		{"duplicate parameter", [][2]string{{"GET", "/a/{id}/{id}"}}},
+		{"unclosed parameter", [][2]string{{"GET", "/a/{id"}}},
+		{"empty parameter", [][2]string{{"GET", "/a/{}"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var routes []*route
+			for _, p := range tt.patterns {
+				routes = append(routes, &route{handler: generated.GeneratedRouteHandler{
+					RouteConfig: config.RouteConfig{Method: p[0], Path: p[1]},
+				}})
+			}
+			if _, err := newRouter(routes); err == nil {
+				t.Fatal("newRouter() error = nil")
+			}
+		})
+	}
+}
+
+func TestServeHTTPRouting(t *testing.T) {
+	h := &Handler{logger: zap.NewNop()}
+	h.router.Store(testRouter(t,
+		[2]string{"GET", "/countries/{iso}"},
+		[2]string{"POST", "/countries/{iso}"},
+	))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{"unknown path", "GET", "/cities/ams", http.StatusNotFound, ""},
+		{"method not allowed", "DELETE", "/countries/NL", http.StatusMethodNotAllowed, "GET, OPTIONS, POST"},
+		{"options", "OPTIONS", "/countries/NL", http.StatusNoContent, "GET, OPTIONS, POST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Allow"); got != tt.wantAllow {
+				t.Fatalf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
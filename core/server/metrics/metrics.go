@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "soap_proxy"
+
+// Metrics holds the Prometheus collectors exposed by the proxy
+type Metrics struct {
+	registry *prometheus.Registry
+
+	RequestDuration  *prometheus.HistogramVec
+	UpstreamDuration *prometheus.HistogramVec
+	RequestsTotal    *prometheus.CounterVec
+	RequestErrors    *prometheus.CounterVec
+	ActiveRequests   *prometheus.GaugeVec
+	UpstreamRetries  *prometheus.CounterVec
+	BreakerState     *prometheus.GaugeVec
+	BreakerChanges   *prometheus.CounterVec
+	EndpointHealthy  *prometheus.GaugeVec
+	CacheRequests    *prometheus.CounterVec
+	Coalesced        *prometheus.CounterVec
+}
+
+// New creates the proxy metrics on a dedicated registry
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		RequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Total time spent handling a REST request, including queueing and templating.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "action", "status"}),
+		UpstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upstream_duration_seconds",
+			Help:      "Time spent waiting for the SOAP backend.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "action", "upstream_status"}),
+		RequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "requests_total",
+			Help:      "Total number of REST requests handled.",
+		}, []string{"route", "action", "status", "upstream_status", "fault_code"}),
+		RequestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "request_errors_total",
+			Help:      "Total number of REST requests that ended in an error.",
+		}, []string{"route", "action", "status", "upstream_status", "fault_code"}),
+		ActiveRequests: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_requests",
+			Help:      "Number of REST requests currently being handled.",
+		}, []string{"route"}),
+		UpstreamRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upstream_retries_total",
+			Help:      "Total number of retried calls to the SOAP backend.",
+		}, []string{"route", "action", "reason"}),
+		BreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "circuit_breaker_state",
+			Help:      "State of the circuit breaker of a SOAP endpoint: 0 closed, 1 half-open, 2 open.",
+		}, []string{"endpoint"}),
+		BreakerChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "circuit_breaker_transitions_total",
+			Help:      "Total number of state changes of the circuit breaker of a SOAP endpoint.",
+		}, []string{"endpoint", "state"}),
+		EndpointHealthy: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "endpoint_healthy",
+			Help:      "Whether a SOAP endpoint is in the rotation of its routes: 1 healthy, 0 ejected or failing its health checks.",
+		}, []string{"endpoint"}),
+		CacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_requests_total",
+			Help:      "Total number of requests to cached routes by cache result: hit, stale or miss.",
+		}, []string{"route", "action", "result"}),
+		Coalesced: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "coalesced_requests_total",
+			Help:      "Total number of requests answered by the SOAP call of an identical request in flight.",
+		}, []string{"route", "action"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.RequestDuration,
+		m.UpstreamDuration,
+		m.RequestsTotal,
+		m.RequestErrors,
+		m.ActiveRequests,
+		m.UpstreamRetries,
+		m.BreakerState,
+		m.BreakerChanges,
+		m.EndpointHealthy,
+		m.CacheRequests,
+		m.Coalesced,
+	)
+
+	return m
+}
+
+// RegisterWorkerPool exposes the worker pool size, usage and queue length as gauges
+func (m *Metrics) RegisterWorkerPool(size, usage, queued func() float64) {
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "worker_pool_size",
+			Help:      "Number of workers in the pool.",
+		}, size),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "worker_pool_usage",
+			Help:      "Number of workers currently processing a request.",
+		}, usage),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "worker_pool_queued",
+			Help:      "Number of requests waiting for a free worker.",
+		}, queued),
+	)
+}
+
+// Handler returns the HTTP handler serving the metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
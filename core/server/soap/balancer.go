@@ -0,0 +1,292 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Load balancing strategies
+const (
+	RoundRobin       = "round_robin"
+	Weighted         = "weighted"
+	LeastOutstanding = "least_outstanding"
+)
+
+const (
+	defaultEjectAfter    = 5
+	defaultEjectDuration = 30 * time.Second
+)
+
+// Endpoint is one node of a SOAP service
+type Endpoint struct {
+	url      string
+	weight   int
+	breaker  *Breaker
+	balancer *Balancer
+
+	outstanding atomic.Int64
+
+	mu sync.Mutex
+	// failures counts the consecutive failed calls
+	failures     int
+	ejected      bool
+	ejectedUntil time.Time
+	// unhealthy is set while the endpoint fails its health checks
+	unhealthy bool
+	// current is the running weight of the weighted strategy
+	current int
+}
+
+// NewEndpoint creates an endpoint, breaker is optional and a weight below 1 counts as 1
+func NewEndpoint(url string, weight int, breaker *Breaker) *Endpoint {
+	if weight < 1 {
+		weight = 1
+	}
+	return &Endpoint{url: url, weight: weight, breaker: breaker}
+}
+
+// URL returns the address of the endpoint
+func (e *Endpoint) URL() string {
+	return e.url
+}
+
+// Breaker returns the circuit breaker of the endpoint, nil when it has none
+func (e *Endpoint) Breaker() *Breaker {
+	return e.breaker
+}
+
+// Outstanding returns the number of calls to the endpoint in flight
+func (e *Endpoint) Outstanding() int64 {
+	return e.outstanding.Load()
+}
+
+// observe records the outcome of a call for the passive health tracking
+func (e *Endpoint) observe(failed bool, now time.Time) {
+	if e.balancer == nil {
+		return
+	}
+
+	e.mu.Lock()
+	if !failed {
+		e.failures = 0
+		e.mu.Unlock()
+		return
+	}
+	e.failures++
+	ejected := e.failures >= e.balancer.opts.EjectAfter && !e.ejected
+	if ejected {
+		e.failures = 0
+		e.ejected = true
+		e.ejectedUntil = now.Add(e.balancer.opts.EjectDuration)
+	}
+	e.mu.Unlock()
+
+	if ejected {
+		e.notify(false, fmt.Sprintf("ejected after %d consecutive failures", e.balancer.opts.EjectAfter))
+	}
+}
+
+// available reports whether the endpoint may receive calls. An ejected
+// endpoint returns to the rotation once its ejection has expired.
+func (e *Endpoint) available(now time.Time) bool {
+	e.mu.Lock()
+	readmitted := e.ejected && !now.Before(e.ejectedUntil)
+	if readmitted {
+		e.ejected = false
+	}
+	ok := !e.ejected && !e.unhealthy
+	e.mu.Unlock()
+
+	if readmitted {
+		e.notify(true, "ejection expired")
+	}
+	return ok && (e.breaker == nil || e.breaker.available(now))
+}
+
+// setHealthy records the result of a health check
+func (e *Endpoint) setHealthy(healthy bool, reason string) {
+	e.mu.Lock()
+	changed := e.unhealthy == healthy
+	e.unhealthy = !healthy
+	e.mu.Unlock()
+
+	if changed {
+		e.notify(healthy, reason)
+	}
+}
+
+func (e *Endpoint) notify(healthy bool, reason string) {
+	if e.balancer != nil && e.balancer.opts.OnHealthChange != nil {
+		e.balancer.opts.OnHealthChange(e.url, healthy, reason)
+	}
+}
+
+// HealthChangeFunc is called when an endpoint leaves or returns to the rotation
+type HealthChangeFunc func(endpoint string, healthy bool, reason string)
+
+// BalancerOptions configures a Balancer. Zero values fall back to the defaults.
+type BalancerOptions struct {
+	// Strategy is RoundRobin, Weighted or LeastOutstanding, RoundRobin when empty
+	Strategy string
+	// EjectAfter consecutive failed calls take an endpoint out of the
+	// rotation for EjectDuration
+	EjectAfter    int
+	EjectDuration time.Duration
+	// OnHealthChange is optional
+	OnHealthChange HealthChangeFunc
+}
+
+// Balancer spreads calls across the endpoints of a SOAP service and keeps
+// failing endpoints out of the rotation
+type Balancer struct {
+	opts      BalancerOptions
+	endpoints []*Endpoint
+	next      atomic.Uint64
+
+	// mu guards the running weights of the weighted strategy
+	mu sync.Mutex
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// NewBalancer creates a balancer over endpoints
+func NewBalancer(endpoints []*Endpoint, opts BalancerOptions) (*Balancer, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("no endpoints to balance")
+	}
+	switch opts.Strategy {
+	case "":
+		opts.Strategy = RoundRobin
+	case RoundRobin, Weighted, LeastOutstanding:
+	default:
+		return nil, fmt.Errorf("unknown load balancing strategy %q", opts.Strategy)
+	}
+	if opts.EjectAfter == 0 {
+		opts.EjectAfter = defaultEjectAfter
+	}
+	if opts.EjectDuration == 0 {
+		opts.EjectDuration = defaultEjectDuration
+	}
+
+	b := &Balancer{
+		opts:      opts,
+		endpoints: endpoints,
+		stop:      make(chan struct{}),
+	}
+	for _, e := range endpoints {
+		e.balancer = b
+	}
+	return b, nil
+}
+
+// Endpoints returns the endpoints of the balancer
+func (b *Balancer) Endpoints() []*Endpoint {
+	return b.endpoints
+}
+
+// Next returns the endpoint of the next call. Ejected, unhealthy endpoints
+// and endpoints whose breaker is open are skipped unless no endpoint is left.
+func (b *Balancer) Next() *Endpoint {
+	now := time.Now()
+	candidates := make([]*Endpoint, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		if e.available(now) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = b.endpoints
+	}
+
+	switch b.opts.Strategy {
+	case Weighted:
+		return b.nextWeighted(candidates)
+	case LeastOutstanding:
+		// Start at a rotating offset so ties are spread evenly
+		start := int(b.next.Add(1) % uint64(len(candidates)))
+		best := candidates[start]
+		for i := 1; i < len(candidates); i++ {
+			e := candidates[(start+i)%len(candidates)]
+			if e.Outstanding() < best.Outstanding() {
+				best = e
+			}
+		}
+		return best
+	default:
+		return candidates[b.next.Add(1)%uint64(len(candidates))]
+	}
+}
+
+// nextWeighted implements the smooth weighted round robin of nginx: every
+// candidate gains its weight, the highest one is picked and loses the total
+func (b *Balancer) nextWeighted(candidates []*Endpoint) *Endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	total := 0
+	var best *Endpoint
+	for _, e := range candidates {
+		e.current += e.weight
+		total += e.weight
+		if best == nil || e.current > best.current {
+			best = e
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// ProbeFunc checks the health of an endpoint
+type ProbeFunc func(ctx context.Context, endpoint *Endpoint) error
+
+// StartHealthChecks probes every endpoint at each interval, right away for
+// the first time, until Stop is called. Endpoints failing their probe are
+// taken out of the rotation until a probe succeeds. The interval and timeout
+// must be positive.
+func (b *Balancer) StartHealthChecks(interval, timeout time.Duration, probe ProbeFunc) error {
+	if interval <= 0 || timeout <= 0 {
+		return fmt.Errorf("health check interval %v and timeout %v must be positive", interval, timeout)
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			b.checkHealth(timeout, probe)
+			select {
+			case <-ticker.C:
+			case <-b.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// checkHealth probes all endpoints concurrently
+func (b *Balancer) checkHealth(timeout time.Duration, probe ProbeFunc) {
+	var wg sync.WaitGroup
+	for _, e := range b.endpoints {
+		wg.Add(1)
+		go func(e *Endpoint) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := probe(ctx, e); err != nil {
+				e.setHealthy(false, "health check failed: "+err.Error())
+				return
+			}
+			e.setHealthy(true, "health check passed")
+		}(e)
+	}
+	wg.Wait()
+}
+
+// Stop stops the health checks of the balancer
+func (b *Balancer) Stop() {
+	b.stopOnce.Do(func() { close(b.stop) })
+}
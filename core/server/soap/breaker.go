@@ -0,0 +1,370 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through and records its outcome
+	BreakerClosed BreakerState = iota
+	// BreakerHalfOpen lets a few probe calls through to test the endpoint
+	BreakerHalfOpen
+	// BreakerOpen rejects every call until the open duration has passed
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// ErrCircuitOpen is wrapped by the errors of calls rejected by a circuit breaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned for a call rejected by a circuit breaker
+type CircuitOpenError struct {
+	// Endpoint is the endpoint the call was meant for
+	Endpoint string
+	// RetryAfter is the time left before the breaker lets probe calls through,
+	// or a short delay while its probe calls are in flight
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return ErrCircuitOpen.Error()
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+const (
+	defaultFailureRate   = 0.5
+	defaultSlowCallRate  = 1.0
+	defaultWindowSize    = 20
+	defaultMinimumCalls  = 10
+	defaultOpenDuration  = 30 * time.Second
+	defaultHalfOpenCalls = 3
+)
+
+// halfOpenRetryAfter is the RetryAfter of calls rejected while the probes of
+// a half-open breaker are in flight, whose outcome is not known yet
+const halfOpenRetryAfter = time.Second
+
+// BreakerOptions configures a circuit breaker. Zero values fall back to the defaults.
+type BreakerOptions struct {
+	// FailureRate opens the breaker when reached by the failed calls of the window
+	FailureRate float64
+	// SlowCallRate opens the breaker when reached by the calls of the window
+	// slower than SlowCallDuration, slow calls are not tracked when it is 0
+	SlowCallRate     float64
+	SlowCallDuration time.Duration
+	// WindowSize is the number of latest calls the rates are computed on
+	WindowSize int
+	// MinimumCalls is the number of calls needed before the rates are evaluated
+	MinimumCalls int
+	// OpenDuration is how long calls are rejected before probing the endpoint
+	OpenDuration time.Duration
+	// HalfOpenCalls is the number of probe calls that must succeed to close the breaker
+	HalfOpenCalls int
+}
+
+func (o BreakerOptions) withDefaults() BreakerOptions {
+	if o.FailureRate == 0 {
+		o.FailureRate = defaultFailureRate
+	}
+	if o.SlowCallRate == 0 {
+		o.SlowCallRate = defaultSlowCallRate
+	}
+	if o.WindowSize == 0 {
+		o.WindowSize = defaultWindowSize
+	}
+	if o.MinimumCalls == 0 {
+		o.MinimumCalls = defaultMinimumCalls
+	}
+	if o.MinimumCalls > o.WindowSize {
+		o.MinimumCalls = o.WindowSize
+	}
+	if o.OpenDuration == 0 {
+		o.OpenDuration = defaultOpenDuration
+	}
+	if o.HalfOpenCalls == 0 {
+		o.HalfOpenCalls = defaultHalfOpenCalls
+	}
+	return o
+}
+
+// StateChangeFunc is called after a circuit breaker changed its state
+type StateChangeFunc func(endpoint string, from, to BreakerState)
+
+// Breaker is the circuit breaker of one SOAP endpoint. It tracks the outcome
+// of the latest calls and rejects calls while the endpoint keeps failing.
+type Breaker struct {
+	endpoint string
+	onChange StateChangeFunc
+
+	mu    sync.Mutex
+	opts  BreakerOptions
+	state BreakerState
+	// generation changes with every state change, outcomes of calls started
+	// in another generation are ignored
+	generation uint64
+	openUntil  time.Time
+
+	// window holds the outcomes of the latest calls while closed
+	window   []callOutcome
+	next     int
+	calls    int
+	failures int
+	slow     int
+
+	// probes and successes count the calls let through while half-open
+	probes    int
+	successes int
+}
+
+// callOutcome describes how a call went
+type callOutcome struct {
+	failed bool
+	slow   bool
+}
+
+// Endpoint returns the endpoint the breaker protects
+func (b *Breaker) Endpoint() string {
+	return b.endpoint
+}
+
+// State returns the current state of the breaker
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow reserves a call. It returns the generation the outcome is recorded
+// against, or a *CircuitOpenError when the call is rejected.
+func (b *Breaker) allow(now time.Time) (uint64, error) {
+	b.mu.Lock()
+	from := b.state
+
+	if b.state == BreakerOpen {
+		if now.Before(b.openUntil) {
+			retryAfter := b.openUntil.Sub(now)
+			b.mu.Unlock()
+			return 0, &CircuitOpenError{Endpoint: b.endpoint, RetryAfter: retryAfter}
+		}
+		b.setState(BreakerHalfOpen, now)
+	}
+
+	if b.state == BreakerHalfOpen {
+		if b.probes >= b.opts.HalfOpenCalls {
+			to := b.state
+			b.mu.Unlock()
+			b.notify(from, to)
+			return 0, &CircuitOpenError{Endpoint: b.endpoint, RetryAfter: halfOpenRetryAfter}
+		}
+		b.probes++
+	}
+
+	generation, to := b.generation, b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+	return generation, nil
+}
+
+// record records the outcome of a call reserved with allow
+func (b *Breaker) record(generation uint64, outcome callOutcome, now time.Time) {
+	b.mu.Lock()
+	from := b.state
+	if generation != b.generation {
+		b.mu.Unlock()
+		return
+	}
+
+	switch b.state {
+	case BreakerClosed:
+		b.add(outcome)
+		if b.tripped() {
+			b.setState(BreakerOpen, now)
+		}
+	case BreakerHalfOpen:
+		if outcome.failed || outcome.slow {
+			b.setState(BreakerOpen, now)
+			break
+		}
+		b.successes++
+		if b.successes >= b.opts.HalfOpenCalls {
+			b.setState(BreakerClosed, now)
+		}
+	}
+
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+// release gives back a call reserved with allow without recording an
+// outcome, for calls cancelled by the caller
+func (b *Breaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation && b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// add puts an outcome into the window of latest calls
+func (b *Breaker) add(outcome callOutcome) {
+	if b.calls == len(b.window) {
+		evicted := b.window[b.next]
+		if evicted.failed {
+			b.failures--
+		}
+		if evicted.slow {
+			b.slow--
+		}
+	} else {
+		b.calls++
+	}
+
+	b.window[b.next] = outcome
+	b.next = (b.next + 1) % len(b.window)
+	if outcome.failed {
+		b.failures++
+	}
+	if outcome.slow {
+		b.slow++
+	}
+}
+
+// tripped reports whether the window exceeds the failure or slow call rate
+func (b *Breaker) tripped() bool {
+	if b.calls < b.opts.MinimumCalls {
+		return false
+	}
+	calls := float64(b.calls)
+	if float64(b.failures)/calls >= b.opts.FailureRate {
+		return true
+	}
+	return b.opts.SlowCallDuration > 0 && float64(b.slow)/calls >= b.opts.SlowCallRate
+}
+
+// setState moves the breaker to a new state and resets its counters
+func (b *Breaker) setState(state BreakerState, now time.Time) {
+	b.state = state
+	b.generation++
+	b.probes, b.successes = 0, 0
+	b.window = make([]callOutcome, b.opts.WindowSize)
+	b.next, b.calls, b.failures, b.slow = 0, 0, 0, 0
+	if state == BreakerOpen {
+		b.openUntil = now.Add(b.opts.OpenDuration)
+	}
+}
+
+func (b *Breaker) notify(from, to BreakerState) {
+	if from != to && b.onChange != nil {
+		b.onChange(b.endpoint, from, to)
+	}
+}
+
+// configure applies new options, a closed breaker starts a new window
+func (b *Breaker) configure(opts BreakerOptions) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	opts = opts.withDefaults()
+	if opts == b.opts {
+		return
+	}
+	b.opts = opts
+	if b.state == BreakerClosed {
+		b.generation++
+		b.window = make([]callOutcome, opts.WindowSize)
+		b.next, b.calls, b.failures, b.slow = 0, 0, 0, 0
+	}
+}
+
+// available reports whether the breaker would let a call through now
+func (b *Breaker) available(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		return !now.Before(b.openUntil)
+	case BreakerHalfOpen:
+		return b.probes < b.opts.HalfOpenCalls
+	}
+	return true
+}
+
+// slowCallDuration returns the duration above which calls are slow, 0 when
+// slow calls are not tracked
+func (b *Breaker) slowCallDuration() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.opts.SlowCallDuration
+}
+
+// outcomeOf classifies a finished call. Network errors and 5xx statuses other
+// than 500, the status of SOAP faults, are failures. ok is false for calls
+// cancelled by the caller, whose outcome says nothing about the endpoint.
+func outcomeOf(req *http.Request, resp *http.Response, err error, elapsed, slowCall time.Duration) (outcome callOutcome, ok bool) {
+	if err != nil && errors.Is(req.Context().Err(), context.Canceled) {
+		return callOutcome{}, false
+	}
+	outcome.failed = err != nil || resp.StatusCode > http.StatusInternalServerError
+	outcome.slow = slowCall > 0 && elapsed >= slowCall
+	return outcome, true
+}
+
+// Breakers holds the circuit breakers of SOAP endpoints. Routes calling the
+// same endpoint share its breaker, and breakers outlive configuration reloads.
+type Breakers struct {
+	onChange StateChangeFunc
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewBreakers creates an empty breaker registry, onChange is optional
+func NewBreakers(onChange StateChangeFunc) *Breakers {
+	return &Breakers{
+		onChange: onChange,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Get returns the breaker of an endpoint, creating it on first use. The
+// options of an existing breaker are replaced while its state is kept.
+func (r *Breakers) Get(endpoint string, opts BreakerOptions) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.breakers[endpoint]; ok {
+		b.configure(opts)
+		return b
+	}
+
+	opts = opts.withDefaults()
+	b := &Breaker{
+		endpoint: endpoint,
+		onChange: r.onChange,
+		opts:     opts,
+		window:   make([]callOutcome, opts.WindowSize),
+	}
+	r.breakers[endpoint] = b
+	return b
+}
@@ -0,0 +1,168 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const testEndpoint = "http://backend.internal/soap"
+
+// breakerStep is one call of a breaker scenario. ok and fail reserve a call
+// and record its outcome, reject expects the call to be rejected. reserve
+// keeps a call pending, and the pending calls are finished in order by
+// pending-ok, pending-fail and pending-release.
+type breakerStep struct {
+	at             time.Duration
+	call           string
+	wantState      BreakerState
+	wantRetryAfter time.Duration
+}
+
+func TestBreaker(t *testing.T) {
+	opts := BreakerOptions{
+		FailureRate:   0.5,
+		WindowSize:    4,
+		MinimumCalls:  4,
+		OpenDuration:  10 * time.Second,
+		HalfOpenCalls: 2,
+	}
+	open := []breakerStep{
+		{call: "fail", wantState: BreakerClosed},
+		{call: "ok", wantState: BreakerClosed},
+		{call: "fail", wantState: BreakerClosed},
+		{call: "ok", wantState: BreakerOpen},
+	}
+
+	tests := []struct {
+		name  string
+		steps []breakerStep
+	}{
+		{
+			name: "stays closed below the minimum calls",
+			steps: []breakerStep{
+				{call: "fail", wantState: BreakerClosed},
+				{call: "fail", wantState: BreakerClosed},
+				{call: "fail", wantState: BreakerClosed},
+			},
+		},
+		{
+			name: "rejects calls while open",
+			steps: append(open[:4:4],
+				breakerStep{at: 4 * time.Second, call: "reject", wantState: BreakerOpen, wantRetryAfter: 6 * time.Second},
+			),
+		},
+		{
+			name: "closes after the half-open probes succeed",
+			steps: append(open[:4:4],
+				breakerStep{at: 10 * time.Second, call: "ok", wantState: BreakerHalfOpen},
+				breakerStep{at: 10 * time.Second, call: "ok", wantState: BreakerClosed},
+				breakerStep{at: 10 * time.Second, call: "fail", wantState: BreakerClosed},
+			),
+		},
+		{
+			name: "opens again on a failed probe",
+			steps: append(open[:4:4],
+				breakerStep{at: 10 * time.Second, call: "fail", wantState: BreakerOpen},
+				breakerStep{at: 15 * time.Second, call: "reject", wantState: BreakerOpen, wantRetryAfter: 5 * time.Second},
+			),
+		},
+		{
+			name: "rejects calls beyond the half-open probes",
+			steps: append(open[:4:4],
+				breakerStep{at: 10 * time.Second, call: "reserve", wantState: BreakerHalfOpen},
+				breakerStep{at: 10 * time.Second, call: "reserve", wantState: BreakerHalfOpen},
+				breakerStep{at: 10 * time.Second, call: "reject", wantState: BreakerHalfOpen, wantRetryAfter: halfOpenRetryAfter},
+				breakerStep{at: 10 * time.Second, call: "pending-release", wantState: BreakerHalfOpen},
+				breakerStep{at: 10 * time.Second, call: "ok", wantState: BreakerHalfOpen},
+				breakerStep{at: 10 * time.Second, call: "pending-ok", wantState: BreakerClosed},
+			),
+		},
+		{
+			name: "ignores a call started before the breaker opened",
+			steps: append([]breakerStep{{call: "reserve", wantState: BreakerClosed}}, append(open[:4:4],
+				breakerStep{at: 10 * time.Second, call: "ok", wantState: BreakerHalfOpen},
+				breakerStep{at: 10 * time.Second, call: "pending-fail", wantState: BreakerHalfOpen},
+				breakerStep{at: 10 * time.Second, call: "ok", wantState: BreakerClosed},
+			)...),
+		},
+		{
+			name: "ignores a success of an earlier half-open period",
+			steps: append(open[:4:4],
+				breakerStep{at: 10 * time.Second, call: "reserve", wantState: BreakerHalfOpen},
+				breakerStep{at: 10 * time.Second, call: "fail", wantState: BreakerOpen},
+				breakerStep{at: 20 * time.Second, call: "ok", wantState: BreakerHalfOpen},
+				breakerStep{at: 20 * time.Second, call: "pending-ok", wantState: BreakerHalfOpen},
+				breakerStep{at: 20 * time.Second, call: "ok", wantState: BreakerClosed},
+			),
+		},
+		{
+			name: "keeps the probes of the current half-open period on a stale release",
+			steps: append(open[:4:4],
+				breakerStep{at: 10 * time.Second, call: "reserve", wantState: BreakerHalfOpen},
+				breakerStep{at: 10 * time.Second, call: "fail", wantState: BreakerOpen},
+				breakerStep{at: 20 * time.Second, call: "reserve", wantState: BreakerHalfOpen},
+				breakerStep{at: 20 * time.Second, call: "reserve", wantState: BreakerHalfOpen},
+				breakerStep{at: 20 * time.Second, call: "pending-release", wantState: BreakerHalfOpen},
+				breakerStep{at: 20 * time.Second, call: "reject", wantState: BreakerHalfOpen, wantRetryAfter: halfOpenRetryAfter},
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var transitions []BreakerState
+			b := NewBreakers(func(endpoint string, from, to BreakerState) {
+				if endpoint != testEndpoint {
+					t.Errorf("state change of endpoint %q, want %q", endpoint, testEndpoint)
+				}
+				transitions = append(transitions, to)
+			}).Get(testEndpoint, opts)
+
+			start := time.Now()
+			var pending []uint64
+			for i, step := range tt.steps {
+				now := start.Add(step.at)
+				switch step.call {
+				case "ok", "fail", "reserve":
+					generation, err := b.allow(now)
+					if err != nil {
+						t.Fatalf("step %d: allow() error = %v", i, err)
+					}
+					if step.call == "reserve" {
+						pending = append(pending, generation)
+						break
+					}
+					b.record(generation, callOutcome{failed: step.call == "fail"}, now)
+				case "reject":
+					_, err := b.allow(now)
+					var open *CircuitOpenError
+					if !errors.As(err, &open) {
+						t.Fatalf("step %d: allow() error = %v, want a CircuitOpenError", i, err)
+					}
+					if open.Endpoint != testEndpoint || open.RetryAfter != step.wantRetryAfter {
+						t.Fatalf("step %d: allow() error = %+v, want endpoint %q and retry after %v", i, open, testEndpoint, step.wantRetryAfter)
+					}
+				case "pending-ok", "pending-fail", "pending-release":
+					generation := pending[0]
+					pending = pending[1:]
+					if step.call == "pending-release" {
+						b.release(generation)
+						break
+					}
+					b.record(generation, callOutcome{failed: step.call == "pending-fail"}, now)
+				default:
+					t.Fatalf("step %d: unknown call %q", i, step.call)
+				}
+
+				if got := b.State(); got != step.wantState {
+					t.Fatalf("step %d (%s): state = %v, want %v", i, step.call, got, step.wantState)
+				}
+			}
+
+			if len(transitions) > 0 && transitions[len(transitions)-1] != b.State() {
+				t.Errorf("last state change to %v, breaker is %v", transitions[len(transitions)-1], b.State())
+			}
+		})
+	}
+}
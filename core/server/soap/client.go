@@ -1,12 +1,36 @@
 package transport
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
 	"time"
 
 	"go.uber.org/zap"
 )
 
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultTLSHandshakeTimeout = 10 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+)
+
+// Options configures the HTTP transport of a Client. Zero values fall back to the defaults.
+type Options struct {
+	Timeout               time.Duration
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	IdleConnTimeout       time.Duration
+	TLSHandshakeTimeout   time.Duration
+	KeepAlive             time.Duration
+	ResponseHeaderTimeout time.Duration
+	// TLS configures HTTPS connections, nil uses the Go defaults
+	TLS *TLSConfig
+}
+
 // Client is a custom HTTP client with logging
 type Client struct {
 	client *http.Client
@@ -15,14 +39,91 @@ type Client struct {
 
 // NewClient creates a new HTTP client with the given timeout
 func NewClient(timeout time.Duration, logger *zap.Logger) *Client {
+	return NewClientWithOptions(Options{Timeout: timeout}, logger)
+}
+
+// NewClientWithOptions creates a new HTTP client with its own connection pool
+func NewClientWithOptions(opts Options, logger *zap.Logger) *Client {
+	if opts.MaxIdleConns == 0 {
+		opts.MaxIdleConns = defaultMaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost == 0 {
+		opts.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if opts.IdleConnTimeout == 0 {
+		opts.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if opts.TLSHandshakeTimeout == 0 {
+		opts.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+	}
+	if opts.KeepAlive == 0 {
+		opts.KeepAlive = defaultKeepAlive
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: opts.KeepAlive,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if opts.TLS != nil {
+		// HTTPS connections are dialed here so that the server certificate
+		// is verified against the dialed host, which the TLS connection
+		// state does not carry for IP addresses
+		transport.TLSClientConfig = opts.TLS.proxied()
+		transport.DialTLSContext = dialTLS(dialer, opts.TLS, opts.TLSHandshakeTimeout)
+	}
+
 	return &Client{
 		client: &http.Client{
-			Timeout: timeout,
+			Timeout:   opts.Timeout,
+			Transport: transport,
 		},
 		logger: logger,
 	}
 }
 
+// dialTLS returns a dial function opening TLS connections configured for
+// the dialed host
+func dialTLS(dialer *net.Dialer, cfg *TLSConfig, handshakeTimeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig, err := cfg.ForHost(host)
+		if err != nil {
+			return nil, err
+		}
+		if len(tlsConfig.NextProtos) == 0 {
+			tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+		}
+
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+		defer cancel()
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
 // Do sends an HTTP request and returns the response
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
 	start := time.Now()
@@ -45,3 +146,46 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 
 	return resp, nil
 }
+
+// DoEndpoint sends a request to one endpoint of a balancer and records the
+// outcome for its circuit breaker and passive health tracking. A
+// *CircuitOpenError is returned without sending the request while the
+// breaker of the endpoint is open.
+func (c *Client) DoEndpoint(req *http.Request, endpoint *Endpoint) (*http.Response, error) {
+	breaker := endpoint.breaker
+	var (
+		generation uint64
+		slowCall   time.Duration
+	)
+	if breaker != nil {
+		var err error
+		generation, err = breaker.allow(time.Now())
+		if err != nil {
+			return nil, err
+		}
+		slowCall = breaker.slowCallDuration()
+	}
+
+	endpoint.outstanding.Add(1)
+	defer endpoint.outstanding.Add(-1)
+
+	start := time.Now()
+	resp, err := c.Do(req)
+	outcome, ok := outcomeOf(req, resp, err, time.Since(start), slowCall)
+	if !ok {
+		if breaker != nil {
+			breaker.release(generation)
+		}
+		return resp, err
+	}
+	if breaker != nil {
+		breaker.record(generation, outcome, time.Now())
+	}
+	endpoint.observe(outcome.failed, time.Now())
+	return resp, err
+}
+
+// CloseIdleConnections closes the idle connections of the client, requests in flight are not affected
+func (c *Client) CloseIdleConnections() {
+	c.client.CloseIdleConnections()
+}
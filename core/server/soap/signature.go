@@ -0,0 +1,435 @@
+package transport
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+
+	"rest-to-soap/core/soapenv"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// XML Signature namespaces and algorithms
+const (
+	DSigNamespace = "http://www.w3.org/2000/09/xmldsig#"
+
+	excC14NAlgorithm = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	rsaSHA256        = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	rsaSHA1          = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	digestSHA256     = "http://www.w3.org/2001/04/xmlenc#sha256"
+	digestSHA1       = "http://www.w3.org/2000/09/xmldsig#sha1"
+	x509TokenType    = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-x509-token-profile-1.0#X509v3"
+)
+
+// ErrInvalidSignature is returned when a response is unsigned or its
+// signature does not verify against the trusted certificate
+var ErrInvalidSignature = errors.New("invalid response signature")
+
+// Signer signs the Body and Timestamp of request envelopes with an X.509
+// key pair, exclusive C14N and RSA-SHA256. The certificate is sent as a
+// BinarySecurityToken referenced from the signature.
+type Signer struct {
+	cert []byte
+	key  *rsa.PrivateKey
+}
+
+// LoadSigner reads a PEM certificate and RSA private key
+func LoadSigner(certFile, keyFile string) (*Signer, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load signing key pair: %w", err)
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an RSA key", keyFile)
+	}
+	return &Signer{cert: pair.Certificate[0], key: key}, nil
+}
+
+// Sign adds a BinarySecurityToken and a ds:Signature over the Body and the
+// wsu:Timestamp to the wsse:Security header of an envelope
+func (s *Signer) Sign(envelope []byte) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(envelope); err != nil {
+		return nil, fmt.Errorf("invalid SOAP envelope: %w", err)
+	}
+	root := doc.Root()
+	body := childNS(root, "", "Body")
+	security := childNS(childNS(root, "", "Header"), WSSENamespace, "Security")
+	if body == nil || security == nil {
+		return nil, errors.New("invalid SOAP envelope: missing Body or wsse:Security header")
+	}
+
+	// Signed parts are referenced by their wsu:Id
+	var targets []*etree.Element
+	if timestamp := childNS(security, WSUNamespace, "Timestamp"); timestamp != nil {
+		targets = append(targets, timestamp)
+	}
+	bodyID, err := newID("Body")
+	if err != nil {
+		return nil, err
+	}
+	body.CreateAttr("xmlns:wsu", WSUNamespace)
+	body.CreateAttr("wsu:Id", bodyID)
+	targets = append(targets, body)
+
+	tokenID, err := newID("X509")
+	if err != nil {
+		return nil, err
+	}
+	token := etree.NewElement("wsse:BinarySecurityToken")
+	token.CreateAttr("EncodingType", base64EncodingType)
+	token.CreateAttr("ValueType", x509TokenType)
+	token.CreateAttr("wsu:Id", tokenID)
+	token.SetText(base64.StdEncoding.EncodeToString(s.cert))
+	security.InsertChildAt(0, token)
+
+	signature := security.CreateElement("ds:Signature")
+	signature.CreateAttr("xmlns:ds", DSigNamespace)
+	signedInfo := signature.CreateElement("ds:SignedInfo")
+	signedInfo.CreateElement("ds:CanonicalizationMethod").CreateAttr("Algorithm", excC14NAlgorithm)
+	signedInfo.CreateElement("ds:SignatureMethod").CreateAttr("Algorithm", rsaSHA256)
+
+	for _, target := range targets {
+		digest, err := digestElement(target, "", sha256.New())
+		if err != nil {
+			return nil, err
+		}
+		reference := signedInfo.CreateElement("ds:Reference")
+		reference.CreateAttr("URI", "#"+elementID(target))
+		reference.CreateElement("ds:Transforms").CreateElement("ds:Transform").CreateAttr("Algorithm", excC14NAlgorithm)
+		reference.CreateElement("ds:DigestMethod").CreateAttr("Algorithm", digestSHA256)
+		reference.CreateElement("ds:DigestValue").SetText(base64.StdEncoding.EncodeToString(digest))
+	}
+
+	canonical, err := canonicalize(signedInfo, "")
+	if err != nil {
+		return nil, err
+	}
+	hashed := sha256.Sum256(canonical)
+	value, err := rsa.SignPKCS1v15(nil, s.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign envelope: %w", err)
+	}
+	signature.CreateElement("ds:SignatureValue").SetText(base64.StdEncoding.EncodeToString(value))
+
+	reference := signature.CreateElement("ds:KeyInfo").
+		CreateElement("wsse:SecurityTokenReference").
+		CreateElement("wsse:Reference")
+	reference.CreateAttr("URI", "#"+tokenID)
+	reference.CreateAttr("ValueType", x509TokenType)
+
+	return doc.WriteToBytes()
+}
+
+// Verifier checks that responses are signed with a trusted certificate
+type Verifier struct {
+	key *rsa.PublicKey
+}
+
+// LoadVerifier reads the PEM certificate responses must be signed with
+func LoadVerifier(certFile string) (*Verifier, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted certificate: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("trusted certificate %s is not a PEM certificate", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trusted certificate: %w", err)
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("trusted certificate %s does not hold an RSA key", certFile)
+	}
+	return &Verifier{key: key}, nil
+}
+
+// Verify checks the ds:Signature in the wsse:Security header of a response.
+// The envelope must have a single Header and Body and nothing else, the
+// signature must cover that Body, every reference must match its digest and
+// the signature value must verify against the trusted certificate. It
+// returns an envelope holding only the verified Body, which is what the
+// response must be read from. Failures wrap ErrInvalidSignature.
+func (v *Verifier) Verify(envelope []byte) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, fmt.Errorf("%w: empty response", ErrInvalidSignature)
+	}
+	header, body, err := envelopeParts(root)
+	if err != nil {
+		return nil, err
+	}
+	signature := childNS(childNS(header, WSSENamespace, "Security"), DSigNamespace, "Signature")
+	if signature == nil {
+		return nil, fmt.Errorf("%w: response is not signed", ErrInvalidSignature)
+	}
+	signedInfo := childNS(signature, DSigNamespace, "SignedInfo")
+	if signedInfo == nil {
+		return nil, fmt.Errorf("%w: missing SignedInfo", ErrInvalidSignature)
+	}
+
+	method := childNS(signedInfo, DSigNamespace, "CanonicalizationMethod")
+	if algorithmOf(method) != excC14NAlgorithm {
+		return nil, fmt.Errorf("%w: unsupported canonicalization method", ErrInvalidSignature)
+	}
+
+	ids := indexIDs(root)
+	bodySigned := false
+	for _, reference := range childrenNS(signedInfo, DSigNamespace, "Reference") {
+		target, err := referencedElement(reference, ids)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkDigest(reference, target); err != nil {
+			return nil, err
+		}
+		if target == body {
+			bodySigned = true
+		}
+	}
+	if !bodySigned {
+		return nil, fmt.Errorf("%w: the Body is not signed", ErrInvalidSignature)
+	}
+
+	canonical, err := canonicalize(signedInfo, prefixList(method))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	value, err := base64.StdEncoding.DecodeString(textOf(childNS(signature, DSigNamespace, "SignatureValue")))
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature value", ErrInvalidSignature)
+	}
+
+	var hashed []byte
+	var algorithm crypto.Hash
+	switch algorithmOf(childNS(signedInfo, DSigNamespace, "SignatureMethod")) {
+	case rsaSHA256:
+		sum := sha256.Sum256(canonical)
+		hashed, algorithm = sum[:], crypto.SHA256
+	case rsaSHA1:
+		sum := sha1.Sum(canonical)
+		hashed, algorithm = sum[:], crypto.SHA1
+	default:
+		return nil, fmt.Errorf("%w: unsupported signature method", ErrInvalidSignature)
+	}
+	if err := rsa.VerifyPKCS1v15(v.key, algorithm, hashed, value); err != nil {
+		return nil, fmt.Errorf("%w: signature does not match the trusted certificate", ErrInvalidSignature)
+	}
+
+	return verifiedEnvelope(root, body)
+}
+
+// envelopeParts returns the Header and Body of a SOAP envelope. Anything but
+// an optional Header followed by one Body is rejected, so a forged Body cannot
+// be placed next to the signed one for the parser to pick up.
+func envelopeParts(root *etree.Element) (header, body *etree.Element, err error) {
+	ns := root.NamespaceURI()
+	if root.Tag != "Envelope" || !soapenv.IsEnvelopeNamespace(ns) {
+		return nil, nil, fmt.Errorf("%w: response is not a SOAP envelope", ErrInvalidSignature)
+	}
+	for _, child := range root.ChildElements() {
+		switch {
+		case child.NamespaceURI() != ns:
+		case child.Tag == "Header" && header == nil && body == nil:
+			header = child
+			continue
+		case child.Tag == "Body" && body == nil:
+			body = child
+			continue
+		}
+		return nil, nil, fmt.Errorf("%w: unexpected %s element in the envelope", ErrInvalidSignature, child.FullTag())
+	}
+	if body == nil {
+		return nil, nil, fmt.Errorf("%w: response has no Body", ErrInvalidSignature)
+	}
+	return header, body, nil
+}
+
+// verifiedEnvelope serializes an envelope holding only the verified Body,
+// with the namespace declarations of the original envelope
+func verifiedEnvelope(root, body *etree.Element) ([]byte, error) {
+	envelope := etree.NewElement(root.FullTag())
+	envelope.Attr = append(envelope.Attr, root.Attr...)
+	envelope.AddChild(body.Copy())
+
+	doc := etree.NewDocument()
+	doc.SetRoot(envelope)
+	return doc.WriteToBytes()
+}
+
+// referencedElement resolves the same-document URI of a ds:Reference.
+// Duplicate ids are rejected so a signed element cannot be swapped for a
+// forged one carrying the same id.
+func referencedElement(reference *etree.Element, ids map[string][]*etree.Element) (*etree.Element, error) {
+	uri := reference.SelectAttrValue("URI", "")
+	if !strings.HasPrefix(uri, "#") {
+		return nil, fmt.Errorf("%w: unsupported reference %q", ErrInvalidSignature, uri)
+	}
+	targets := ids[uri[1:]]
+	if len(targets) != 1 {
+		return nil, fmt.Errorf("%w: reference %q matches %d elements", ErrInvalidSignature, uri, len(targets))
+	}
+	return targets[0], nil
+}
+
+// checkDigest compares the digest of a reference with its canonicalized target
+func checkDigest(reference, target *etree.Element) error {
+	var prefixes string
+	for _, transform := range childrenNS(childNS(reference, DSigNamespace, "Transforms"), DSigNamespace, "Transform") {
+		if algorithmOf(transform) != excC14NAlgorithm {
+			return fmt.Errorf("%w: unsupported transform", ErrInvalidSignature)
+		}
+		prefixes = prefixList(transform)
+	}
+
+	var h hash.Hash
+	switch algorithmOf(childNS(reference, DSigNamespace, "DigestMethod")) {
+	case digestSHA256:
+		h = sha256.New()
+	case digestSHA1:
+		h = sha1.New()
+	default:
+		return fmt.Errorf("%w: unsupported digest method", ErrInvalidSignature)
+	}
+
+	digest, err := digestElement(target, prefixes, h)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	expected, err := base64.StdEncoding.DecodeString(textOf(childNS(reference, DSigNamespace, "DigestValue")))
+	if err != nil || !bytes.Equal(digest, expected) {
+		return fmt.Errorf("%w: digest of %s does not match", ErrInvalidSignature, target.Tag)
+	}
+	return nil
+}
+
+// digestElement hashes the exclusive canonical form of an element
+func digestElement(el *etree.Element, prefixes string, h hash.Hash) ([]byte, error) {
+	canonical, err := canonicalize(el, prefixes)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(canonical)
+	return h.Sum(nil), nil
+}
+
+// canonicalize serializes an element with exclusive C14N. The namespaces in
+// scope at the element are declared on a detached copy first so prefixes
+// declared by ancestors resolve.
+func canonicalize(el *etree.Element, prefixes string) ([]byte, error) {
+	ctx := etreeutils.NewDefaultNSContext()
+	var ancestors []*etree.Element
+	for p := el.Parent(); p != nil && p.Tag != ""; p = p.Parent() {
+		ancestors = append(ancestors, p)
+	}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		var err error
+		if ctx, err = ctx.SubContext(ancestors[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	detached, err := etreeutils.NSDetatch(ctx, el)
+	if err != nil {
+		return nil, err
+	}
+	return dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(prefixes).Canonicalize(detached)
+}
+
+// prefixList returns the InclusiveNamespaces PrefixList of a c14n method or transform
+func prefixList(el *etree.Element) string {
+	for _, child := range el.ChildElements() {
+		if child.Tag == "InclusiveNamespaces" {
+			return child.SelectAttrValue("PrefixList", "")
+		}
+	}
+	return ""
+}
+
+// indexIDs maps the wsu:Id and Id attributes of a document to their elements
+func indexIDs(root *etree.Element) map[string][]*etree.Element {
+	ids := make(map[string][]*etree.Element)
+	var walk func(*etree.Element)
+	walk = func(el *etree.Element) {
+		if id := elementID(el); id != "" {
+			ids[id] = append(ids[id], el)
+		}
+		for _, child := range el.ChildElements() {
+			walk(child)
+		}
+	}
+	walk(root)
+	return ids
+}
+
+// elementID returns the wsu:Id of an element, or its unqualified Id
+func elementID(el *etree.Element) string {
+	for i := range el.Attr {
+		attr := &el.Attr[i]
+		if attr.Key == "Id" && (attr.Space == "" || attr.NamespaceURI() == WSUNamespace) {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// childNS returns the first child element with a local name, in a namespace
+// unless ns is empty. It is nil-safe.
+func childNS(el *etree.Element, ns, local string) *etree.Element {
+	children := childrenNS(el, ns, local)
+	if len(children) == 0 {
+		return nil
+	}
+	return children[0]
+}
+
+func childrenNS(el *etree.Element, ns, local string) []*etree.Element {
+	if el == nil {
+		return nil
+	}
+	var children []*etree.Element
+	for _, child := range el.ChildElements() {
+		if child.Tag == local && (ns == "" || child.NamespaceURI() == ns) {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// algorithmOf returns the Algorithm attribute of an element, nil-safe
+func algorithmOf(el *etree.Element) string {
+	if el == nil {
+		return ""
+	}
+	return el.SelectAttrValue("Algorithm", "")
+}
+
+// textOf returns the trimmed text of an element, nil-safe
+func textOf(el *etree.Element) string {
+	if el == nil {
+		return ""
+	}
+	return strings.TrimSpace(el.Text())
+}
@@ -0,0 +1,190 @@
+package transport
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const unsignedResponse = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">` +
+	`<soap:Body><m:CountryFlagResponse xmlns:m="http://www.oorsprong.org/websamples.countryinfo">` +
+	`<m:CountryFlagResult>flag.jpg</m:CountryFlagResult>` +
+	`</m:CountryFlagResponse></soap:Body></soap:Envelope>`
+
+const forgedBody = `<soap:Body><m:CountryFlagResponse xmlns:m="http://www.oorsprong.org/websamples.countryinfo">` +
+	`<m:CountryFlagResult>EVIL</m:CountryFlagResult>` +
+	`</m:CountryFlagResponse></soap:Body>`
+
+// newKeyPair writes a self-signed RSA certificate and its key to dir
+func newKeyPair(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "soap-service"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// signedResponse returns the test response signed by a new key pair and a
+// verifier trusting it
+func signedResponse(t *testing.T) (string, *Verifier) {
+	t.Helper()
+	certFile, keyFile := newKeyPair(t, t.TempDir())
+	signer, err := LoadSigner(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := LoadVerifier(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	security := &Security{Signer: signer}
+	signed, err := security.Apply([]byte(unsignedResponse), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed), verifier
+}
+
+// moveSignedBody moves the signed Body into the Header and puts a forged
+// Body in its place
+func moveSignedBody(t *testing.T, envelope string) string {
+	t.Helper()
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(envelope); err != nil {
+		t.Fatal(err)
+	}
+	root := doc.Root()
+	header := childNS(root, "", "Header")
+	body := childNS(root, "", "Body")
+	root.RemoveChild(body)
+	header.AddChild(body)
+
+	forged := etree.NewDocument()
+	if err := forged.ReadFromString(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">` + forgedBody + `</soap:Envelope>`); err != nil {
+		t.Fatal(err)
+	}
+	root.AddChild(childNS(forged.Root(), "", "Body").Copy())
+
+	out, err := doc.WriteToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestVerify(t *testing.T) {
+	signed, verifier := signedResponse(t)
+
+	tests := []struct {
+		name     string
+		envelope func() string
+		valid    bool
+	}{
+		{
+			name:     "good signature",
+			envelope: func() string { return signed },
+			valid:    true,
+		},
+		{
+			name:     "tampered body",
+			envelope: func() string { return strings.Replace(signed, "flag.jpg", "EVIL", 1) },
+		},
+		{
+			name:     "second body after the signed one",
+			envelope: func() string { return strings.Replace(signed, "</soap:Envelope>", forgedBody+"</soap:Envelope>", 1) },
+		},
+		{
+			name: "second body before the signed one",
+			envelope: func() string {
+				i := strings.Index(signed, "<soap:Body")
+				return signed[:i] + forgedBody + signed[i:]
+			},
+		},
+		{
+			name:     "unexpected element in the envelope",
+			envelope: func() string { return strings.Replace(signed, "</soap:Envelope>", "<soap:Extra/></soap:Envelope>", 1) },
+		},
+		{
+			name:     "unsigned body",
+			envelope: func() string { return unsignedResponse },
+		},
+		{
+			name:     "signed body moved to the header",
+			envelope: func() string { return moveSignedBody(t, signed) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified, err := verifier.Verify([]byte(tt.envelope()))
+			if !tt.valid {
+				if !errors.Is(err, ErrInvalidSignature) {
+					t.Fatalf("Verify() error = %v, want ErrInvalidSignature", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+
+			doc := etree.NewDocument()
+			if err := doc.ReadFromBytes(verified); err != nil {
+				t.Fatalf("verified envelope does not parse: %v", err)
+			}
+			root := doc.Root()
+			if len(root.ChildElements()) != 1 || childNS(root, "", "Body") == nil {
+				t.Fatalf("verified envelope holds %d elements, want only the Body", len(root.ChildElements()))
+			}
+			if !strings.Contains(string(verified), "flag.jpg") {
+				t.Fatalf("verified envelope %s lost the response", verified)
+			}
+		})
+	}
+}
+
+func TestVerifyUntrustedCertificate(t *testing.T) {
+	signed, _ := signedResponse(t)
+	certFile, _ := newKeyPair(t, t.TempDir())
+	other, err := LoadVerifier(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := other.Verify([]byte(signed)); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Verify() error = %v, want ErrInvalidSignature", err)
+	}
+}
@@ -0,0 +1,252 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSOptions configures the TLS connections of a Client
+type TLSOptions struct {
+	// CAFile is a PEM bundle of trusted CAs, the system roots are used when empty
+	CAFile string
+	// CertFile and KeyFile hold the client certificate, both or neither must be set
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the host name used for SNI and certificate verification
+	ServerName string
+	// MinVersion is the lowest accepted version: "1.0", "1.1", "1.2" or "1.3"
+	MinVersion string
+	// CipherSuites lists the allowed TLS 1.0-1.2 cipher suites by name
+	CipherSuites []string
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig is the client TLS configuration of a Client
+type TLSConfig struct {
+	config *tls.Config
+	// roots holds the CA bundle, nil uses the system roots
+	roots *reloadingFile[*x509.CertPool]
+}
+
+// NewTLSConfig builds a client TLS configuration and loads its certificate
+// files. The CA bundle and client certificate are re-read on later handshakes
+// when their files change, so rotated certificates are picked up without a
+// restart; a rotation that cannot be loaded keeps the previous certificates.
+func NewTLSConfig(opts TLSOptions) (*TLSConfig, error) {
+	cfg := &tls.Config{
+		ServerName: opts.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if opts.MinVersion != "" {
+		version, ok := tlsVersions[opts.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version %q", opts.MinVersion)
+		}
+		cfg.MinVersion = version
+	}
+
+	if len(opts.CipherSuites) > 0 {
+		suites, err := cipherSuites(opts.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		cfg.CipherSuites = suites
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, errors.New("a client certificate requires both cert_file and key_file")
+		}
+		cert := &reloadingFile[*tls.Certificate]{
+			files: []string{opts.CertFile, opts.KeyFile},
+			load: func() (*tls.Certificate, error) {
+				pair, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed to load client certificate: %w", err)
+				}
+				return &pair, nil
+			},
+		}
+		if _, err := cert.get(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert.get()
+		}
+	}
+
+	c := &TLSConfig{config: cfg}
+	if opts.CAFile != "" {
+		c.roots = &reloadingFile[*x509.CertPool]{
+			files: []string{opts.CAFile},
+			load: func() (*x509.CertPool, error) {
+				return loadCertPool(opts.CAFile)
+			},
+		}
+		if _, err := c.roots.get(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// ForHost returns the configuration of a connection dialed to host. The
+// server certificate is verified against the ServerName option, or else the
+// host, and the current CA bundle.
+func (c *TLSConfig) ForHost(host string) (*tls.Config, error) {
+	cfg := c.config.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	if c.roots != nil {
+		pool, err := c.roots.get()
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// proxied returns the configuration of the connections the http.Transport
+// opens itself through an HTTP proxy. Their host is not known here, so with a
+// CA bundle the certificate can only be verified against the ServerName
+// option and the connection is refused without it.
+func (c *TLSConfig) proxied() *tls.Config {
+	if c.roots == nil {
+		return c.config
+	}
+	cfg := c.config.Clone()
+	// The standard verification reads a fixed RootCAs pool, so it is
+	// replaced by the same checks against the current CA bundle
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if c.config.ServerName == "" {
+			return errors.New("tls: server_name is required to verify a backend reached through a proxy against ca_file")
+		}
+		pool, err := c.roots.get()
+		if err != nil {
+			return err
+		}
+		return verifyPeer(cs, pool, c.config.ServerName)
+	}
+	return cfg
+}
+
+// verifyPeer verifies the certificate chain of a connection and its host name
+func verifyPeer(cs tls.ConnectionState, roots *x509.CertPool, serverName string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server presented no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// cipherSuites maps cipher suite names to their ids, only the suites Go
+// considers secure are accepted
+func cipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// reloadCheckInterval limits how often certificate files are checked for changes
+const reloadCheckInterval = 10 * time.Second
+
+// reloadingFile caches a value loaded from files and loads it again when the
+// modification time or size of one of the files changes
+type reloadingFile[T any] struct {
+	files []string
+	load  func() (T, error)
+
+	mu      sync.Mutex
+	value   T
+	loaded  bool
+	stamp   string
+	checked time.Time
+}
+
+// get returns the current value, the previous value is kept when the files
+// changed but cannot be loaded
+func (r *reloadingFile[T]) get() (T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if r.loaded && now.Sub(r.checked) < reloadCheckInterval {
+		return r.value, nil
+	}
+	r.checked = now
+
+	stamp, err := r.stat()
+	if r.loaded && (err != nil || stamp == r.stamp) {
+		return r.value, nil
+	}
+
+	value, err := r.load()
+	if err != nil {
+		if r.loaded {
+			return r.value, nil
+		}
+		return value, err
+	}
+	r.value, r.loaded, r.stamp = value, true, stamp
+	return value, nil
+}
+
+// stat summarizes the modification times and sizes of the files
+func (r *reloadingFile[T]) stat() (string, error) {
+	var stamp string
+	for _, file := range r.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%s:%d:%d;", file, info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
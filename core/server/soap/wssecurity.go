@@ -0,0 +1,247 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WS-Security namespaces and token types
+const (
+	WSSENamespace = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	WSUNamespace  = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+
+	tokenProfile       = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0"
+	passwordTextType   = tokenProfile + "#PasswordText"
+	passwordDigestType = tokenProfile + "#PasswordDigest"
+	base64EncodingType = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary"
+)
+
+// wsuTimeFormat is the UTC format of wsu:Created and wsu:Expires
+const wsuTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// Security adds a WS-Security header to request envelopes
+type Security struct {
+	// Username and Password add a UsernameToken when Username is set
+	Username string
+	Password string
+	// PasswordDigest sends Base64(SHA-1(nonce + created + password)) instead
+	// of the clear text password
+	PasswordDigest bool
+	// TimestampTTL adds a wsu:Timestamp expiring after the duration, 0 disables it
+	TimestampTTL time.Duration
+	// MustUnderstand marks the header as mandatory for the receiver
+	MustUnderstand bool
+	// Signer signs the Body and Timestamp of requests when set
+	Signer *Signer
+	// Verifier checks the signature of responses when set
+	Verifier *Verifier
+}
+
+// defaultSignedTimestampTTL is the Timestamp lifetime of signed requests
+// without a configured TTL
+const defaultSignedTimestampTTL = 5 * time.Minute
+
+// Apply inserts the wsse:Security header into a SOAP envelope, creating the
+// SOAP Header when the envelope has none, and signs the envelope when a
+// Signer is set. Every call uses a fresh nonce and creation time.
+func (s *Security) Apply(envelope []byte, now time.Time) ([]byte, error) {
+	if s.Username == "" && s.TimestampTTL == 0 && s.Signer == nil {
+		return envelope, nil
+	}
+
+	env, err := locateEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := s.header(env, now)
+	if err != nil {
+		return nil, err
+	}
+	secured := env.insertHeader(header)
+
+	if s.Signer == nil {
+		return secured, nil
+	}
+	return s.Signer.Sign(secured)
+}
+
+// header renders the wsse:Security element
+func (s *Security) header(env *envelopeLayout, now time.Time) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(`<wsse:Security xmlns:wsse="` + WSSENamespace + `" xmlns:wsu="` + WSUNamespace + `"`)
+	if s.MustUnderstand {
+		fmt.Fprintf(&b, ` xmlns:wsenv="%s" wsenv:mustUnderstand="1"`, env.namespace)
+	}
+	b.WriteString(`>`)
+
+	created := now.UTC().Format(wsuTimeFormat)
+
+	// Signed requests always carry a Timestamp so they cannot be replayed later
+	ttl := s.TimestampTTL
+	if ttl == 0 && s.Signer != nil {
+		ttl = defaultSignedTimestampTTL
+	}
+	if ttl > 0 {
+		id, err := newID("TS")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, `<wsu:Timestamp wsu:Id="%s"><wsu:Created>%s</wsu:Created><wsu:Expires>%s</wsu:Expires></wsu:Timestamp>`,
+			id, created, now.Add(ttl).UTC().Format(wsuTimeFormat))
+	}
+
+	if s.Username != "" {
+		id, err := newID("UsernameToken")
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("failed to generate nonce: %w", err)
+		}
+
+		passwordType, password := passwordTextType, s.Password
+		if s.PasswordDigest {
+			passwordType, password = passwordDigestType, PasswordDigest(nonce, created, s.Password)
+		}
+
+		fmt.Fprintf(&b, `<wsse:UsernameToken wsu:Id="%s"><wsse:Username>%s</wsse:Username>`, id, escapeText(s.Username))
+		fmt.Fprintf(&b, `<wsse:Password Type="%s">%s</wsse:Password>`, passwordType, escapeText(password))
+		fmt.Fprintf(&b, `<wsse:Nonce EncodingType="%s">%s</wsse:Nonce>`, base64EncodingType, base64.StdEncoding.EncodeToString(nonce))
+		fmt.Fprintf(&b, `<wsu:Created>%s</wsu:Created></wsse:UsernameToken>`, created)
+	}
+
+	b.WriteString(`</wsse:Security>`)
+	return b.Bytes(), nil
+}
+
+// PasswordDigest computes the UsernameToken password digest
+// Base64(SHA-1(nonce + created + password))
+func PasswordDigest(nonce []byte, created, password string) string {
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(password))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// envelopeLayout locates the parts of a serialized SOAP envelope so header
+// blocks can be inserted without re-encoding the envelope
+type envelopeLayout struct {
+	data []byte
+	// prefix and namespace of the envelope elements
+	prefix    string
+	namespace string
+	// headerStart and headerEnd delimit the start tag of an existing Header,
+	// both are -1 when the envelope has no Header
+	headerStart, headerEnd int
+	headerEmpty            bool
+	// bodyStart is the offset of the Body start tag
+	bodyStart int
+}
+
+func locateEnvelope(data []byte) (*envelopeLayout, error) {
+	env := &envelopeLayout{data: data, headerStart: -1, headerEnd: -1, bodyStart: -1}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	depth := 0
+	for env.bodyStart < 0 {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.RawToken()
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOAP envelope: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 1:
+				if t.Name.Local != "Envelope" {
+					return nil, fmt.Errorf("invalid SOAP envelope: unexpected root element %s", t.Name.Local)
+				}
+				env.prefix = t.Name.Space
+				env.namespace = namespaceOf(t, t.Name.Space)
+			case depth == 2 && t.Name.Local == "Header":
+				env.headerStart = offset
+				env.headerEnd = int(decoder.InputOffset())
+				env.headerEmpty = bytes.HasSuffix(data[offset:env.headerEnd], []byte("/>"))
+			case depth == 2 && t.Name.Local == "Body":
+				env.bodyStart = offset
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	return env, nil
+}
+
+// insertHeader returns the envelope with a block added at the start of its Header
+func (e *envelopeLayout) insertHeader(block []byte) []byte {
+	open, close := "<"+e.qualified("Header")+">", "</"+e.qualified("Header")+">"
+
+	var out bytes.Buffer
+	out.Grow(len(e.data) + len(block) + len(open) + len(close))
+	switch {
+	case e.headerStart < 0:
+		out.Write(e.data[:e.bodyStart])
+		out.WriteString(open)
+		out.Write(block)
+		out.WriteString(close)
+		out.Write(e.data[e.bodyStart:])
+	case e.headerEmpty:
+		out.Write(e.data[:e.headerStart])
+		out.WriteString(open)
+		out.Write(block)
+		out.WriteString(close)
+		out.Write(e.data[e.headerEnd:])
+	default:
+		out.Write(e.data[:e.headerEnd])
+		out.Write(block)
+		out.Write(e.data[e.headerEnd:])
+	}
+	return out.Bytes()
+}
+
+func (e *envelopeLayout) qualified(local string) string {
+	if e.prefix == "" {
+		return local
+	}
+	return e.prefix + ":" + local
+}
+
+// namespaceOf returns the namespace an element declares for a prefix
+func namespaceOf(start xml.StartElement, prefix string) string {
+	for _, attr := range start.Attr {
+		if prefix == "" && attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+			return attr.Value
+		}
+		if prefix != "" && attr.Name.Space == "xmlns" && attr.Name.Local == prefix {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// newID returns a random wsu:Id with a prefix
+func newID(prefix string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate id: %w", err)
+	}
+	return prefix + "-" + strings.ToUpper(hex.EncodeToString(b)), nil
+}
+
+func escapeText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
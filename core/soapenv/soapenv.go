@@ -0,0 +1,40 @@
+// Package soapenv holds the envelope namespaces and media types of the SOAP
+// versions supported by the proxy.
+package soapenv
+
+import (
+	"fmt"
+
+	"rest-to-soap/core/config"
+)
+
+// Envelope namespaces of SOAP 1.1 and SOAP 1.2
+const (
+	Namespace11 = "http://schemas.xmlsoap.org/soap/envelope/"
+	Namespace12 = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// Namespace returns the envelope namespace of a SOAP version, SOAP 1.1 by default
+func Namespace(version string) string {
+	if version == config.SoapVersion12 {
+		return Namespace12
+	}
+	return Namespace11
+}
+
+// IsEnvelopeNamespace reports whether ns is the envelope namespace of a supported SOAP version
+func IsEnvelopeNamespace(ns string) bool {
+	return ns == Namespace11 || ns == Namespace12
+}
+
+// ContentType returns the Content-Type of a request. SOAP 1.2 carries the
+// action as a media type parameter instead of a SOAPAction header.
+func ContentType(version, action string) string {
+	if version != config.SoapVersion12 {
+		return "text/xml;charset=UTF-8"
+	}
+	if action == "" {
+		return "application/soap+xml;charset=UTF-8"
+	}
+	return fmt.Sprintf("application/soap+xml;charset=UTF-8;action=%q", action)
+}
@@ -0,0 +1,307 @@
+package templating
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"rest-to-soap/core/config"
+	"rest-to-soap/core/schema"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	xmlNameType = reflect.TypeOf(xml.Name{})
+)
+
+// MarshalAuto renders a typed SOAP response as JSON without a template.
+// Object keys come from the XML element names, converted with the given naming
+// strategy (camelCase, original or snake_case). Fields in XSD order are kept,
+// optional elements (omitempty) are dropped when empty and repeated elements
+// are always rendered as arrays.
+func MarshalAuto(v interface{}, naming string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeAuto(&buf, reflect.ValueOf(v), naming); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalAutoSchema renders the generic values of a route in dynamic mode as
+// JSON. Object keys follow the XSD order of the element model, keys that are
+// not part of the model come last in alphabetical order.
+func MarshalAutoSchema(v interface{}, elem *schema.Element, naming string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeSchema(&buf, v, elem, naming); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeSchema(buf *bytes.Buffer, v interface{}, elem *schema.Element, naming string) error {
+	switch value := v.(type) {
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeSchema(buf, item, elem, naming); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case map[string]interface{}:
+		if elem == nil {
+			break
+		}
+		buf.WriteByte('{')
+		first := true
+		known := make(map[string]bool, len(elem.Children))
+		writeField := func(key string, item interface{}, child *schema.Element) error {
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+			if err := encodeValue(buf, convertName(key, naming)); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			return encodeSchema(buf, item, child, naming)
+		}
+
+		for _, child := range elem.Children {
+			known[child.Name] = true
+			item, ok := value[child.Name]
+			if !ok {
+				continue
+			}
+			if err := writeField(child.Name, item, child); err != nil {
+				return err
+			}
+		}
+
+		var extra []string
+		for key := range value {
+			if !known[key] {
+				extra = append(extra, key)
+			}
+		}
+		sort.Strings(extra)
+		for _, key := range extra {
+			if err := writeField(key, value[key], nil); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	}
+	return encodeAuto(buf, reflect.ValueOf(v), naming)
+}
+
+func encodeAuto(buf *bytes.Buffer, v reflect.Value, naming string) error {
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		return encodeAuto(buf, v.Elem(), naming)
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return encodeValue(buf, v.Interface())
+		}
+		return encodeStruct(buf, v, naming)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return encodeValue(buf, v.Interface())
+		}
+		return encodeMap(buf, v, naming)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return encodeValue(buf, v.Interface())
+		}
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeAuto(buf, v.Index(i), naming); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+	return encodeValue(buf, v.Interface())
+}
+
+func encodeStruct(buf *bytes.Buffer, v reflect.Value, naming string) error {
+	buf.WriteByte('{')
+	first := true
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Type == xmlNameType {
+			continue
+		}
+
+		name, omitEmpty, skip := autoFieldName(field)
+		if skip {
+			continue
+		}
+
+		value := v.Field(i)
+		isList := value.Kind() == reflect.Slice && field.Type.Elem().Kind() != reflect.Uint8
+		if omitEmpty && !isList && value.IsZero() {
+			continue
+		}
+
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		if err := encodeValue(buf, convertName(name, naming)); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+
+		// A missing repeated element is an empty list, not null
+		if isList && value.IsNil() {
+			buf.WriteString("[]")
+			continue
+		}
+		if err := encodeAuto(buf, value, naming); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func encodeMap(buf *bytes.Buffer, v reflect.Value, naming string) error {
+	keys := make([]string, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := encodeValue(buf, convertName(key, naming)); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if err := encodeAuto(buf, v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())), naming); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func encodeValue(buf *bytes.Buffer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
+
+// autoFieldName returns the XML name of a struct field and whether it is optional
+func autoFieldName(field reflect.StructField) (name string, omitEmpty, skip bool) {
+	tag := field.Tag.Get("xml")
+	if tag == "-" {
+		return "", false, true
+	}
+
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	// Drop the namespace of `xml:"namespace local"` tags
+	if idx := strings.LastIndex(name, " "); idx != -1 {
+		name = name[idx+1:]
+	}
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "omitempty":
+			omitEmpty = true
+		case "chardata":
+			if name == "" {
+				name = "value"
+			}
+		case "innerxml", "comment":
+			return "", false, true
+		}
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, omitEmpty, false
+}
+
+// convertName converts an XSD element name using a naming strategy
+func convertName(name, naming string) string {
+	switch naming {
+	case config.FieldNamingOriginal:
+		return name
+	case config.FieldNamingSnakeCase:
+		return strings.Join(lowerWords(name), "_")
+	}
+
+	words := lowerWords(name)
+	for i := 1; i < len(words); i++ {
+		words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+	}
+	return strings.Join(words, "")
+}
+
+// lowerWords splits an identifier such as `sCountryISOCode` or `country-name`
+// into lower-case words: s, country, iso, code
+func lowerWords(name string) []string {
+	runes := []rune(name)
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, strings.ToLower(string(current)))
+			current = current[:0]
+		}
+	}
+
+	for i, r := range runes {
+		if r == '_' || r == '-' || r == '.' || r == ' ' {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(current) > 0 {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			// Split before a new word, or at the end of an acronym (ISOCode -> ISO, Code)
+			if !unicode.IsUpper(prev) || nextIsLower {
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+
+	if len(words) == 0 {
+		return []string{name}
+	}
+	return words
+}
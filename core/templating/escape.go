@@ -0,0 +1,171 @@
+package templating
+
+import (
+	"fmt"
+	"path/filepath"
+	"text/template"
+	"text/template/parse"
+)
+
+// Names of the escapers inserted into templates. The leading underscore keeps
+// them apart from the functions meant to be called by hand.
+const (
+	escapeXML        = "_escape_xml"
+	escapeJSONString = "_escape_json_string"
+	escapeJSONValue  = "_escape_json_value"
+)
+
+// xmlEscapers and jsonEscapers are the functions that already produce safe
+// output in request and response templates, actions ending in one of them are
+// left untouched. An escaper of the other context does not count, its output
+// is escaped again.
+var (
+	xmlEscapers = map[string]bool{
+		"xml":     true,
+		"raw":     true,
+		escapeXML: true,
+	}
+	jsonEscapers = map[string]bool{
+		"json":           true,
+		"jsonString":     true,
+		"raw":            true,
+		escapeJSONString: true,
+		escapeJSONValue:  true,
+	}
+)
+
+// ParseRequestTemplate parses a SOAP request template. Every action is XML escaped
+// unless it ends in an explicit escaper such as `raw`.
+func ParseRequestTemplate(path string) (*template.Template, error) {
+	tmpl, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		escapeXMLNode(t.Tree, t.Tree.Root)
+	}
+	return tmpl, nil
+}
+
+// ParseResponseTemplate parses a JSON response template. Actions inside a JSON
+// string are escaped as string content, actions elsewhere are rendered as JSON values.
+func ParseResponseTemplate(path string) (*template.Template, error) {
+	tmpl, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		escapeJSONNode(t.Tree, t.Tree.Root, false)
+	}
+	return tmpl, nil
+}
+
+func parseFile(path string) (*template.Template, error) {
+	tmpl, err := template.New(filepath.Base(path)).Funcs(Funcs()).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// escapeXMLNode appends the XML escaper to every action below node
+func escapeXMLNode(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeXMLNode(tree, child)
+		}
+	case *parse.ActionNode:
+		appendEscaper(tree, n.Pipe, escapeXML, xmlEscapers)
+	case *parse.IfNode:
+		escapeXMLNode(tree, n.List)
+		escapeXMLNode(tree, n.ElseList)
+	case *parse.RangeNode:
+		escapeXMLNode(tree, n.List)
+		escapeXMLNode(tree, n.ElseList)
+	case *parse.WithNode:
+		escapeXMLNode(tree, n.List)
+		escapeXMLNode(tree, n.ElseList)
+	}
+}
+
+// escapeJSONNode appends a JSON escaper to every action below node, tracking
+// whether the output at that point is inside a JSON string. It returns the
+// string state after node.
+func escapeJSONNode(tree *parse.Tree, node parse.Node, inString bool) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return inString
+		}
+		for _, child := range n.Nodes {
+			inString = escapeJSONNode(tree, child, inString)
+		}
+	case *parse.TextNode:
+		inString = scanJSONText(n.Text, inString)
+	case *parse.ActionNode:
+		if inString {
+			appendEscaper(tree, n.Pipe, escapeJSONString, jsonEscapers)
+		} else {
+			appendEscaper(tree, n.Pipe, escapeJSONValue, jsonEscapers)
+		}
+	case *parse.IfNode:
+		escapeJSONNode(tree, n.ElseList, inString)
+		inString = escapeJSONNode(tree, n.List, inString)
+	case *parse.RangeNode:
+		escapeJSONNode(tree, n.ElseList, inString)
+		inString = escapeJSONNode(tree, n.List, inString)
+	case *parse.WithNode:
+		escapeJSONNode(tree, n.ElseList, inString)
+		inString = escapeJSONNode(tree, n.List, inString)
+	}
+	return inString
+}
+
+// scanJSONText returns whether the output is inside a JSON string after text
+func scanJSONText(text []byte, inString bool) bool {
+	escaped := false
+	for _, c := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		}
+	}
+	return inString
+}
+
+// appendEscaper adds `| escaper` to the pipeline unless it already ends in one
+// of the escapers of its context or only declares variables
+func appendEscaper(tree *parse.Tree, pipe *parse.PipeNode, escaper string, escapers map[string]bool) {
+	if pipe == nil || len(pipe.Decl) > 0 || len(pipe.Cmds) == 0 {
+		return
+	}
+
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	if len(last.Args) > 0 {
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && escapers[ident.Ident] {
+			return
+		}
+	}
+
+	pipe.Cmds = append(pipe.Cmds, &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      pipe.Pos,
+		Args:     []parse.Node{parse.NewIdentifier(escaper).SetTree(tree).SetPos(pipe.Pos)},
+	})
+}
@@ -0,0 +1,51 @@
+package templating
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+)
+
+func TestEscapeByContext(t *testing.T) {
+	const value = "a\"<&\\\n"
+	tests := []struct {
+		name  string
+		parse func(string) (*template.Template, error)
+		text  string
+		want  string
+	}{
+		{"request action", ParseRequestTemplate, `<v>{{ .x }}</v>`, `<v>a&#34;&lt;&amp;\&#xA;</v>`},
+		{"request xml", ParseRequestTemplate, `<v>{{ .x | xml }}</v>`, `<v>a&#34;&lt;&amp;\&#xA;</v>`},
+		{"request raw", ParseRequestTemplate, `<v>{{ .x | raw }}</v>`, "<v>" + value + "</v>"},
+		{"request json", ParseRequestTemplate, `<v>{{ .x | json }}</v>`, `<v>&#34;a\&#34;\u003c\u0026\\\n&#34;</v>`},
+		{"request jsonString", ParseRequestTemplate, `<v>{{ .x | jsonString }}</v>`, `<v>a\&#34;\u003c\u0026\\\n</v>`},
+		{"response string", ParseResponseTemplate, `{"v": "{{ .x }}"}`, `{"v": "a\"\u003c\u0026\\\n"}`},
+		{"response value", ParseResponseTemplate, `{"v": {{ .x }}}`, `{"v": "a\"\u003c\u0026\\\n"}`},
+		{"response json", ParseResponseTemplate, `{"v": {{ .x | json }}}`, `{"v": "a\"\u003c\u0026\\\n"}`},
+		{"response raw", ParseResponseTemplate, `{"v": "{{ .x | raw }}"}`, `{"v": "` + value + `"}`},
+		{"response xml in string", ParseResponseTemplate, `{"v": "{{ .x | xml }}"}`, `{"v": "a\u0026#34;\u0026lt;\u0026amp;\\\u0026#xA;"}`},
+		{"response xml as value", ParseResponseTemplate, `{"v": {{ .x | xml }}}`, `{"v": "a\u0026#34;\u0026lt;\u0026amp;\\\u0026#xA;"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "template.tmpl")
+			if err := os.WriteFile(path, []byte(tt.text), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			tmpl, err := tt.parse(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := tmpl.Execute(&out, map[string]interface{}{"x": value}); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %s, want %s", out.String(), tt.want)
+			}
+		})
+	}
+}
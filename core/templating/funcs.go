@@ -0,0 +1,178 @@
+package templating
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// dateLayouts are the layouts tried when a date is given as a string
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// Funcs returns the functions available to request and response templates
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"xml":          xmlEscape,
+		"json":         jsonValue,
+		"jsonString":   jsonString,
+		"raw":          raw,
+		"default":      defaultValue,
+		"required":     required,
+		"formatDate":   formatDate,
+		"formatNumber": formatNumber,
+
+		// Escapers inserted automatically by Parse*Template, see escape.go
+		escapeXML:        xmlEscape,
+		escapeJSONString: jsonString,
+		escapeJSONValue:  jsonValue,
+	}
+}
+
+// xmlEscape escapes a value for use in XML text or attribute values
+func xmlEscape(v interface{}) string {
+	var buf bytes.Buffer
+	// EscapeText only fails if the writer fails, which a bytes.Buffer never does
+	_ = xml.EscapeText(&buf, []byte(toString(v)))
+	return buf.String()
+}
+
+// jsonValue renders a value as a JSON literal, including quotes for strings
+func jsonValue(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// jsonString escapes a value for use inside a JSON string literal, without the quotes
+func jsonString(v interface{}) string {
+	// Marshalling a string never fails
+	data, _ := json.Marshal(toString(v))
+	return string(data[1 : len(data)-1])
+}
+
+// raw marks a value as safe, so it is written without escaping
+func raw(v interface{}) string {
+	return toString(v)
+}
+
+// defaultValue returns def when v is nil, empty or a zero value
+func defaultValue(def, v interface{}) interface{} {
+	if isEmpty(v) {
+		return def
+	}
+	return v
+}
+
+// required fails the template with msg when v is nil, empty or a zero value
+func required(msg string, v interface{}) (interface{}, error) {
+	if isEmpty(v) {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+// formatDate formats a time.Time or a date string using a Go time layout
+func formatDate(layout string, v interface{}) (string, error) {
+	switch value := v.(type) {
+	case nil:
+		return "", nil
+	case time.Time:
+		return value.Format(layout), nil
+	case *time.Time:
+		if value == nil {
+			return "", nil
+		}
+		return value.Format(layout), nil
+	}
+
+	s := strings.TrimSpace(toString(v))
+	if s == "" {
+		return "", nil
+	}
+	for _, l := range dateLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t.Format(layout), nil
+		}
+	}
+	return "", fmt.Errorf("formatDate: cannot parse %q as a date", s)
+}
+
+// formatNumber formats a number or numeric string with a fixed number of decimals
+func formatNumber(decimals int, v interface{}) (string, error) {
+	var f float64
+	switch value := v.(type) {
+	case nil:
+		return "", nil
+	case float64:
+		f = value
+	case float32:
+		f = float64(value)
+	case int:
+		f = float64(value)
+	case int64:
+		f = float64(value)
+	case json.Number:
+		parsed, err := value.Float64()
+		if err != nil {
+			return "", fmt.Errorf("formatNumber: %w", err)
+		}
+		f = parsed
+	default:
+		s := strings.TrimSpace(toString(v))
+		if s == "" {
+			return "", nil
+		}
+		parsed, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return "", fmt.Errorf("formatNumber: cannot parse %q as a number", s)
+		}
+		f = parsed
+	}
+	return strconv.FormatFloat(f, 'f', decimals, 64), nil
+}
+
+// toString converts a template value to its textual form, nil becomes empty
+func toString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	case fmt.Stringer:
+		return value.String()
+	case float64:
+		// JSON numbers decode to float64, avoid the exponent format for large values
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return rv.IsZero()
+}
@@ -0,0 +1,145 @@
+// Package xmltree decodes arbitrary XML into a generic element tree, for
+// documents such as SOAP fault details that have no generated Go type.
+package xmltree
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Node is an XML element with its attributes, text content and child elements
+type Node struct {
+	Name     xml.Name
+	Attrs    []xml.Attr
+	Text     string
+	Children []*Node
+}
+
+// Decode parses an XML document and returns its root element
+func Decode(data []byte) (*Node, error) {
+	var root Node
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// UnmarshalXML implements xml.Unmarshaler so a Node can be embedded in typed structs
+func (n *Node) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	n.Name = start.Name
+	n.Attrs = start.Attr
+
+	var text strings.Builder
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			child := &Node{}
+			if err := child.UnmarshalXML(d, t); err != nil {
+				return err
+			}
+			n.Children = append(n.Children, child)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			n.Text = strings.TrimSpace(text.String())
+			return nil
+		}
+	}
+}
+
+// Child returns the first child element with the given local name
+func (n *Node) Child(local string) *Node {
+	if n == nil {
+		return nil
+	}
+	for _, child := range n.Children {
+		if child.Name.Local == local {
+			return child
+		}
+	}
+	return nil
+}
+
+// ChildrenNamed returns the child elements with the given local name
+func (n *Node) ChildrenNamed(local string) []*Node {
+	if n == nil {
+		return nil
+	}
+	var children []*Node
+	for _, child := range n.Children {
+		if child.Name.Local == local {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// Find follows a path of local names from the node, nil when an element is missing
+func (n *Node) Find(path ...string) *Node {
+	current := n
+	for _, local := range path {
+		current = current.Child(local)
+		if current == nil {
+			return nil
+		}
+	}
+	return current
+}
+
+// ChildText returns the text of the first child element with the given local name
+func (n *Node) ChildText(local string) string {
+	if child := n.Child(local); child != nil {
+		return child.Text
+	}
+	return ""
+}
+
+// Value converts the element into JSON-friendly values. Elements with only
+// text become strings, other elements become maps keyed by the local names
+// of their children, repeated children become lists, attributes are added
+// as `@name` and mixed text content as `#text`. Namespace declarations are
+// dropped.
+func (n *Node) Value() interface{} {
+	attrs := n.attributes()
+	if len(n.Children) == 0 && len(attrs) == 0 {
+		return n.Text
+	}
+
+	out := make(map[string]interface{}, len(n.Children)+len(attrs))
+	for _, attr := range attrs {
+		out["@"+attr.Name.Local] = attr.Value
+	}
+	for _, child := range n.Children {
+		key := child.Name.Local
+		value := child.Value()
+		switch existing := out[key].(type) {
+		case nil:
+			out[key] = value
+		case []interface{}:
+			out[key] = append(existing, value)
+		default:
+			out[key] = []interface{}{existing, value}
+		}
+	}
+	if n.Text != "" {
+		out["#text"] = n.Text
+	}
+	return out
+}
+
+// attributes returns the attributes of the element without namespace declarations
+func (n *Node) attributes() []xml.Attr {
+	var attrs []xml.Attr
+	for _, attr := range n.Attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs
+}
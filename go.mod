@@ -2,6 +2,22 @@ module rest-to-soap
 
 go 1.21
 
-require go.uber.org/zap v1.26.0
+require (
+	github.com/beevik/etree v1.2.0
+	github.com/prometheus/client_golang v1.19.1
+	github.com/russellhaering/goxmldsig v1.4.0
+	go.uber.org/zap v1.26.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
-require go.uber.org/multierr v1.11.0 // indirect
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/jonboulle/clockwork v0.2.2 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	go.uber.org/multierr v1.11.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
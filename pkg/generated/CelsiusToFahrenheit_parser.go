@@ -1,10 +1,10 @@
 package generated
 
 import (
-	"bytes"
 	"encoding/xml"
 	"fmt"
-	"text/template"
+	"rest-to-soap/core/schema"
+	"rest-to-soap/core/soapenv"
 )
 
 type FahrenheitToCelsius struct {
@@ -25,32 +25,39 @@ type CelsiusToFahrenheit struct {
 
 
 
-// CelsiusToFahrenheitParser parses the SOAP response for the CelsiusToFahrenheit operation
-func CelsiusToFahrenheitParse(xmlData []byte) (string, error) {
-	fmt.Println(string(xmlData))
+// CelsiusToFahrenheitRequestSchema describes the CelsiusToFahrenheit request element, used to validate JSON requests
+var CelsiusToFahrenheitRequestSchema = &schema.Element{
+	Name:      "CelsiusToFahrenheit",
+	MinOccurs: 1,
+	MaxOccurs: 1,
+	Children: []*schema.Element{
+		{
+			Name:      "Celsius",
+			Type:      "string",
+			MinOccurs: 0,
+			MaxOccurs: 1,
+		},
+	},
+}
 
-	// Define the SOAP envelope structure with the proper response type
+// CelsiusToFahrenheitParse parses the SOAP response for the CelsiusToFahrenheit operation into its typed response element
+func CelsiusToFahrenheitParse(xmlData []byte) (interface{}, error) {
+	// Define the SOAP envelope structure with the proper response type, the
+	// envelope namespace is checked below so SOAP 1.1 and 1.2 are both accepted
 	var response struct {
-		XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+		XMLName xml.Name `xml:"Envelope"`
 		Body    struct {
 			Response CelsiusToFahrenheitResponse `xml:"CelsiusToFahrenheitResponse"`
-		} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+		} `xml:"Body"`
 	}
 
 	// Unmarshal the XML into our strongly-typed struct
 	if err := xml.Unmarshal(xmlData, &response); err != nil {
-		return "", fmt.Errorf("failed to unmarshal XML: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal XML: %w", err)
 	}
-
-	// Parse and execute the template
-	tmpl, err := template.ParseFiles("config/templates/celsius-to-farenheit-response.tmpl")
-	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
+	if !soapenv.IsEnvelopeNamespace(response.XMLName.Space) {
+		return nil, fmt.Errorf("unexpected SOAP envelope namespace %q", response.XMLName.Space)
 	}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, response.Body.Response); err != nil {
-		return "", fmt.Errorf("failed to execute template: %w", err)
-	}
-	return buf.String(), nil
+	return response.Body.Response, nil
 }
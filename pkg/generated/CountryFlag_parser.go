@@ -1,10 +1,10 @@
 package generated
 
 import (
-	"bytes"
 	"encoding/xml"
 	"fmt"
-	"text/template"
+	"rest-to-soap/core/schema"
+	"rest-to-soap/core/soapenv"
 )
 
 type CountryCurrencyResponse struct {
@@ -16,11 +16,11 @@ type ListOfLanguagesByCodeResponse struct {
 }
 
 type ArrayOftContinent struct {
-	TContinent []tContinent `xml:"tContinent"`
+	TContinent []tContinent `xml:"tContinent,omitempty"`
 }
 
 type ArrayOftCountryInfo struct {
-	TCountryInfo []tCountryInfo `xml:"tCountryInfo"`
+	TCountryInfo []tCountryInfo `xml:"tCountryInfo,omitempty"`
 }
 
 type FullCountryInfoAllCountriesResponse struct {
@@ -74,7 +74,7 @@ type ListOfCountryNamesByNameResponse struct {
 }
 
 type ArrayOftLanguage struct {
-	TLanguage []tLanguage `xml:"tLanguage"`
+	TLanguage []tLanguage `xml:"tLanguage,omitempty"`
 }
 
 type FullCountryInfoResponse struct {
@@ -101,7 +101,7 @@ type CountryISOCode struct {
 }
 
 type ArrayOftCountryCodeAndNameGroupedByContinent struct {
-	TCountryCodeAndNameGroupedByContinent []tCountryCodeAndNameGroupedByContinent `xml:"tCountryCodeAndNameGroupedByContinent"`
+	TCountryCodeAndNameGroupedByContinent []tCountryCodeAndNameGroupedByContinent `xml:"tCountryCodeAndNameGroupedByContinent,omitempty"`
 }
 
 type FullCountryInfo struct {
@@ -147,7 +147,7 @@ type ListOfLanguagesByNameResponse struct {
 }
 
 type ArrayOftCurrency struct {
-	TCurrency []tCurrency `xml:"tCurrency"`
+	TCurrency []tCurrency `xml:"tCurrency,omitempty"`
 }
 
 type CountriesUsingCurrency struct {
@@ -201,7 +201,7 @@ type CountryName struct {
 }
 
 type ArrayOftCountryCodeAndName struct {
-	TCountryCodeAndName []tCountryCodeAndName `xml:"tCountryCodeAndName"`
+	TCountryCodeAndName []tCountryCodeAndName `xml:"tCountryCodeAndName,omitempty"`
 }
 
 type CountriesUsingCurrencyResponse struct {
@@ -227,32 +227,39 @@ type CapitalCityResponse struct {
 
 
 
-// CountryFlagParser parses the SOAP response for the CountryFlag operation
-func CountryFlagParse(xmlData []byte) (string, error) {
-	fmt.Println(string(xmlData))
+// CountryFlagRequestSchema describes the CountryFlag request element, used to validate JSON requests
+var CountryFlagRequestSchema = &schema.Element{
+	Name:      "CountryFlag",
+	MinOccurs: 1,
+	MaxOccurs: 1,
+	Children: []*schema.Element{
+		{
+			Name:      "sCountryISOCode",
+			Type:      "string",
+			MinOccurs: 1,
+			MaxOccurs: 1,
+		},
+	},
+}
 
-	// Define the SOAP envelope structure with the proper response type
+// CountryFlagParse parses the SOAP response for the CountryFlag operation into its typed response element
+func CountryFlagParse(xmlData []byte) (interface{}, error) {
+	// Define the SOAP envelope structure with the proper response type, the
+	// envelope namespace is checked below so SOAP 1.1 and 1.2 are both accepted
 	var response struct {
-		XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+		XMLName xml.Name `xml:"Envelope"`
 		Body    struct {
 			Response CountryFlagResponse `xml:"CountryFlagResponse"`
-		} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+		} `xml:"Body"`
 	}
 
 	// Unmarshal the XML into our strongly-typed struct
 	if err := xml.Unmarshal(xmlData, &response); err != nil {
-		return "", fmt.Errorf("failed to unmarshal XML: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal XML: %w", err)
 	}
-
-	// Parse and execute the template
-	tmpl, err := template.ParseFiles("config/templates/response.tmpl")
-	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
+	if !soapenv.IsEnvelopeNamespace(response.XMLName.Space) {
+		return nil, fmt.Errorf("unexpected SOAP envelope namespace %q", response.XMLName.Space)
 	}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, response.Body.Response); err != nil {
-		return "", fmt.Errorf("failed to execute template: %w", err)
-	}
-	return buf.String(), nil
+	return response.Body.Response, nil
 }
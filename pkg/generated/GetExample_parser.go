@@ -1,10 +1,10 @@
 package generated
 
 import (
-	"bytes"
 	"encoding/xml"
 	"fmt"
-	"text/template"
+	"rest-to-soap/core/schema"
+	"rest-to-soap/core/soapenv"
 )
 
 type ExampleType struct {
@@ -22,32 +22,39 @@ type GetExampleRequest struct {
 
 
 
-// GetExampleParser parses the SOAP response for the GetExample operation
-func GetExampleParse(xmlData []byte) (string, error) {
-	fmt.Println(string(xmlData))
+// GetExampleRequestSchema describes the GetExample request element, used to validate JSON requests
+var GetExampleRequestSchema = &schema.Element{
+	Name:      "GetExampleRequest",
+	MinOccurs: 1,
+	MaxOccurs: 1,
+	Children: []*schema.Element{
+		{
+			Name:      "id",
+			Type:      "string",
+			MinOccurs: 1,
+			MaxOccurs: 1,
+		},
+	},
+}
 
-	// Define the SOAP envelope structure with the proper response type
+// GetExampleParse parses the SOAP response for the GetExample operation into its typed response element
+func GetExampleParse(xmlData []byte) (interface{}, error) {
+	// Define the SOAP envelope structure with the proper response type, the
+	// envelope namespace is checked below so SOAP 1.1 and 1.2 are both accepted
 	var response struct {
-		XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
+		XMLName xml.Name `xml:"Envelope"`
 		Body    struct {
 			Response GetExampleResponse `xml:"GetExampleResponse"`
-		} `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+		} `xml:"Body"`
 	}
 
 	// Unmarshal the XML into our strongly-typed struct
 	if err := xml.Unmarshal(xmlData, &response); err != nil {
-		return "", fmt.Errorf("failed to unmarshal XML: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal XML: %w", err)
 	}
-
-	// Parse and execute the template
-	tmpl, err := template.ParseFiles("config/templates/response.tmpl")
-	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
+	if !soapenv.IsEnvelopeNamespace(response.XMLName.Space) {
+		return nil, fmt.Errorf("unexpected SOAP envelope namespace %q", response.XMLName.Space)
 	}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, response.Body.Response); err != nil {
-		return "", fmt.Errorf("failed to execute template: %w", err)
-	}
-	return buf.String(), nil
+	return response.Body.Response, nil
 }
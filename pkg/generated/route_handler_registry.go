@@ -2,7 +2,10 @@
 package generated
 
 import (
+	"fmt"
 	"rest-to-soap/core/config"
+	"rest-to-soap/core/schema"
+	"rest-to-soap/core/templating"
 	"text/template"
 	
 	"go.uber.org/zap"
@@ -10,7 +13,9 @@ import (
 
 type GeneratedRouteHandler struct {
 	RouteConfig      config.RouteConfig
-	Parser           func([]byte) (string, error)
+	Parser           func([]byte) (interface{}, error)
+	RequestSchema    *schema.Element
+	ResponseSchema   *schema.Element
 	RequestTemplate  template.Template
 	ResponseTemplate template.Template
 }
@@ -19,50 +24,67 @@ type RouteRegistry map[string]GeneratedRouteHandler
 
 var RouteHandlerRegistry = RouteRegistry{
 	
-			"/api/soap/countries": {
-				RouteConfig: config.RouteConfig{Path:"/api/soap/countries", Method:"POST", SoapEndpoint:"http://webservices.oorsprong.org/websamples.countryinfo/CountryInfoService.wso", SoapAction:"CountryFlag", RequestTemplate:"config/templates/request.tmpl", ResponseTemplate:"config/templates/response.tmpl", Headers:map[string]string{"Content-Type":"text/xml;charset=UTF-8", "SOAPAction":"CountryFlag"}, WSDLURL:"config/wsdl/wsdl.xml", Timeout:30000000000},
+			"GET /api/soap/countries/{iso}/flag": {
+				RouteConfig: config.RouteConfig{SoapEndpoint: "http://webservices.oorsprong.org/websamples.countryinfo/CountryInfoService.wso", SoapVersion: "1.1", SoapActionURI: "", BindingStyle: "document"},
 				Parser:      CountryFlagParse,
+				RequestSchema: CountryFlagRequestSchema,
 				RequestTemplate: template.Template{},
 				ResponseTemplate: template.Template{},
 			},
 		
-			"/api/soap/degrees/celsius-to-fahrenheit": {
-				RouteConfig: config.RouteConfig{Path:"/api/soap/degrees/celsius-to-fahrenheit", Method:"POST", SoapEndpoint:"https://www.w3schools.com/xml/tempconvert.asmx", SoapAction:"CelsiusToFahrenheit", RequestTemplate:"config/templates/celsius-to-farenheit-request.tmpl", ResponseTemplate:"config/templates/celsius-to-farenheit-response.tmpl", Headers:map[string]string{"Content-Type":"text/xml;charset=UTF-8"}, WSDLURL:"https://www.w3schools.com/xml/tempconvert.asmx?WSDL", Timeout:30000000000},
+			"POST /api/soap/degrees/celsius-to-fahrenheit": {
+				RouteConfig: config.RouteConfig{SoapEndpoint: "https://www.w3schools.com/xml/tempconvert.asmx", SoapVersion: "1.1", SoapActionURI: "https://www.w3schools.com/xml/CelsiusToFahrenheit", BindingStyle: "document"},
 				Parser:      CelsiusToFahrenheitParse,
+				RequestSchema: CelsiusToFahrenheitRequestSchema,
 				RequestTemplate: template.Template{},
 				ResponseTemplate: template.Template{},
 			},
 		
-			"/api/soap/example": {
-				RouteConfig: config.RouteConfig{Path:"/api/soap/example", Method:"POST", SoapEndpoint:"http://example.com/service", SoapAction:"GetExample", RequestTemplate:"config/templates/request.tmpl", ResponseTemplate:"config/templates/response.tmpl", Headers:map[string]string{"Content-Type":"text/xml;charset=UTF-8", "SOAPAction":"GetExample"}, WSDLURL:"config/wsdl/wsdl-with-import.xml", Timeout:30000000000},
+			"POST /api/soap/example": {
+				RouteConfig: config.RouteConfig{SoapEndpoint: "http://example.com/service", SoapVersion: "1.1", SoapActionURI: "GetExample", BindingStyle: "document"},
 				Parser:      GetExampleParse,
+				RequestSchema: GetExampleRequestSchema,
 				RequestTemplate: template.Template{},
 				ResponseTemplate: template.Template{},
 			},
 		
 }
 
-// Hydrate the route registry with the templates
+// Hydrate a new route registry with the configured routes and their templates.
+// The generated registry is only read, so the server can hydrate a new registry
+// on every reload while requests still use the previous one.
 func GenerateRouteRegistry(cfg *config.Config, logger *zap.Logger) (RouteRegistry, error) {
+	registry := make(RouteRegistry, len(cfg.Routes))
 	for _, route := range cfg.Routes {
-		requestTmpl, err := template.ParseFiles(route.RequestTemplate)
+		requestTmpl, err := templating.ParseRequestTemplate(route.RequestTemplate)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("route %s: %w", route.Key(), err)
 		}
 
-		responseTmpl, err := template.ParseFiles(route.ResponseTemplate)
-		if err != nil {
-			return nil, err
+		// Routes in auto response mode are rendered without a template
+		responseTmpl := &template.Template{}
+		if route.ResponseTemplate != "" {
+			responseTmpl, err = templating.ParseResponseTemplate(route.ResponseTemplate)
+			if err != nil {
+				return nil, fmt.Errorf("route %s: %w", route.Key(), err)
+			}
 		}
 
-		RouteHandlerRegistry[route.Path] = GeneratedRouteHandler{
+		generated := RouteHandlerRegistry[route.Key()]
+
+		// Endpoint, SOAP version and soapAction default to the values read from the WSDL
+		route = route.WithDefaults(generated.RouteConfig)
+
+		registry[route.Key()] = GeneratedRouteHandler{
 			RouteConfig:      route,
-			Parser:           RouteHandlerRegistry[route.Path].Parser,
+			Parser:           generated.Parser,
+			RequestSchema:    generated.RequestSchema,
+			ResponseSchema:   generated.ResponseSchema,
 			RequestTemplate:  *requestTmpl,
 			ResponseTemplate: *responseTmpl,
 		}
 	}
 
-	return RouteHandlerRegistry, nil
+	return registry, nil
 }
 	
\ No newline at end of file